@@ -1,13 +1,21 @@
 module github.com/doitintl/cluster-scheduler
 
-go 1.14
+go 1.15
 
 require (
 	cloud.google.com/go v0.56.0
 	github.com/aws/aws-sdk-go-v2 v0.21.0
+	github.com/golang/protobuf v1.3.5
+	github.com/googleapis/gax-go/v2 v2.0.5
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.5.0
 	github.com/urfave/cli/v2 v2.0.0
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	google.golang.org/api v0.20.0
 	google.golang.org/genproto v0.0.0-20200410110633-0848e9f44c36
+	google.golang.org/grpc v1.28.0
+	gopkg.in/yaml.v2 v2.2.8
+	k8s.io/api v0.18.2
+	k8s.io/apimachinery v0.18.2
+	k8s.io/client-go v0.18.2
 )
@@ -0,0 +1,222 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// supported output formats
+	FORMAT_TABLE = "table"
+	FORMAT_JSON  = "json"
+	FORMAT_YAML  = "yaml"
+)
+
+type NodePool struct {
+	Name         string `json:"name" yaml:"name"`
+	NodeCount    int32  `json:"nodeCount" yaml:"nodeCount"`
+	MinNodeCount int32  `json:"minNodeCount" yaml:"minNodeCount"`
+	MaxNodeCount int32  `json:"maxNodeCount" yaml:"maxNodeCount"`
+	Autoscaling  bool   `json:"autoscaling" yaml:"autoscaling"`
+	// node pool own schedule and status, if any
+	Schedule string `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	Status   string `json:"status,omitempty" yaml:"status,omitempty"`
+	Desired  string `json:"desired,omitempty" yaml:"desired,omitempty"`
+}
+
+type Transition struct {
+	Time   string `json:"time" yaml:"time"`
+	Status string `json:"status" yaml:"status"`
+}
+
+// Cluster is a cluster record for list output
+type Cluster struct {
+	Name           string      `json:"name" yaml:"name"`
+	Location       string      `json:"location" yaml:"location"`
+	Project        string      `json:"project,omitempty" yaml:"project,omitempty"`
+	Status         string      `json:"status" yaml:"status"`
+	Schedule       string      `json:"schedule" yaml:"schedule"`
+	Desired        string      `json:"desired" yaml:"desired"`
+	NextTransition *Transition `json:"nextTransition,omitempty" yaml:"nextTransition,omitempty"`
+	NodePools      []NodePool  `json:"nodePools" yaml:"nodePools"`
+	// error reading cluster schedule or node pools
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// NewClusters converts clusters into list output records, sorted by project, location and name
+func NewClusters(clusters []scheduler.Cluster, now time.Time) []Cluster {
+	result := make([]Cluster, 0, len(clusters))
+	for _, c := range clusters {
+		out := Cluster{
+			Name:      c.Name,
+			Location:  c.Location,
+			Project:   c.Project,
+			Status:    c.Status,
+			Schedule:  c.Schedule.String(),
+			Desired:   c.DesiredStatus(now),
+			NodePools: make([]NodePool, 0, len(c.Nodes)),
+		}
+		if c.Err != nil {
+			// schedule is unknown
+			out.Error, out.Desired = c.Err.Error(), ""
+		} else if t, status := c.NextTransition(now); status != "" {
+			out.NextTransition = &Transition{Time: t.UTC().Format(time.RFC3339), Status: status}
+		}
+		for _, np := range c.Nodes {
+			pool := NodePool{
+				Name:         np.Name,
+				NodeCount:    np.NodeCount,
+				MinNodeCount: np.MinNodeCount,
+				MaxNodeCount: np.MaxNodeCount,
+				Autoscaling:  np.Autoscaling,
+			}
+			if np.Schedule != nil {
+				pool.Schedule = np.Schedule.String()
+				pool.Status = c.NodeGroupStatus(np)
+				pool.Desired = c.DesiredNodeGroupStatus(np, now)
+			}
+			out.NodePools = append(out.NodePools, pool)
+		}
+		sort.Slice(out.NodePools, func(i, j int) bool { return out.NodePools[i].Name < out.NodePools[j].Name })
+		result = append(result, out)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.Location != b.Location {
+			return a.Location < b.Location
+		}
+		return a.Name < b.Name
+	})
+	return result
+}
+
+// WriteClusters writes clusters in table, JSON or YAML format
+func WriteClusters(w io.Writer, format string, clusters []scheduler.Cluster, now time.Time) error {
+	out := NewClusters(clusters, now)
+	return write(w, format, out, func() error { return writeTable(w, out) })
+}
+
+// Backup is a cluster backup snapshot record for backup list output
+type Backup struct {
+	Cluster   string     `json:"cluster" yaml:"cluster"`
+	Snapshot  string     `json:"snapshot" yaml:"snapshot"`
+	Time      string     `json:"time" yaml:"time"`
+	NodePools []NodePool `json:"nodePools" yaml:"nodePools"`
+}
+
+// NewBackups converts backup snapshots into list output records, sorted by cluster and time
+func NewBackups(backups []*scheduler.ClusterBackup) []Backup {
+	result := make([]Backup, 0, len(backups))
+	for _, b := range backups {
+		out := Backup{
+			Cluster:   b.Cluster,
+			Snapshot:  b.Snapshot(),
+			Time:      b.Time.UTC().Format(time.RFC3339),
+			NodePools: make([]NodePool, 0, len(b.NodeGroups)),
+		}
+		for name, ng := range b.NodeGroups {
+			out.NodePools = append(out.NodePools, NodePool{
+				Name:         name,
+				NodeCount:    ng.NodeCount,
+				MinNodeCount: ng.MinNodeCount,
+				MaxNodeCount: ng.MaxNodeCount,
+				Autoscaling:  ng.Autoscaling,
+			})
+		}
+		sort.Slice(out.NodePools, func(i, j int) bool { return out.NodePools[i].Name < out.NodePools[j].Name })
+		result = append(result, out)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Cluster != result[j].Cluster {
+			return result[i].Cluster < result[j].Cluster
+		}
+		return result[i].Snapshot < result[j].Snapshot
+	})
+	return result
+}
+
+// WriteBackups writes backup snapshots in table, JSON or YAML format
+func WriteBackups(w io.Writer, format string, backups []*scheduler.ClusterBackup) error {
+	out := NewBackups(backups)
+	return write(w, format, out, func() error { return writeBackupTable(w, out) })
+}
+
+// write writes records in JSON or YAML format, or as table
+func write(w io.Writer, format string, out interface{}, table func() error) error {
+	switch format {
+	case FORMAT_TABLE, "":
+		return table()
+	case FORMAT_JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case FORMAT_YAML:
+		enc := yaml.NewEncoder(w)
+		defer enc.Close()
+		return enc.Encode(out)
+	default:
+		return errors.Errorf("unsupported output format '%s'", format)
+	}
+}
+
+func writeTable(w io.Writer, clusters []Cluster) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tLOCATION\tPROJECT\tSTATUS\tSCHEDULE\tDESIRED\tNEXT\tNODE POOLS")
+	for _, c := range clusters {
+		next := "-"
+		if c.NextTransition != nil {
+			next = fmt.Sprintf("%s at %s", c.NextTransition.Status, c.NextTransition.Time)
+		}
+		schedule := c.Schedule
+		if c.Error != "" {
+			schedule = "error: " + c.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Name, orDash(c.Location), orDash(c.Project), orDash(c.Status), schedule, orDash(c.Desired), next, orDash(formatNodePools(c.NodePools)))
+	}
+	return tw.Flush()
+}
+
+func writeBackupTable(w io.Writer, backups []Backup) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLUSTER\tSNAPSHOT\tTIME\tNODE POOLS")
+	for _, b := range backups {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", b.Cluster, b.Snapshot, b.Time, orDash(formatNodePools(b.NodePools)))
+	}
+	return tw.Flush()
+}
+
+func formatNodePools(nodePools []NodePool) string {
+	var pools []string
+	for _, np := range nodePools {
+		pool := fmt.Sprintf("%s=%d", np.Name, np.NodeCount)
+		if np.Autoscaling {
+			pool += fmt.Sprintf("[%d-%d]", np.MinNodeCount, np.MaxNodeCount)
+		}
+		// node pool with own schedule: status and desired status
+		if np.Schedule != "" {
+			pool += fmt.Sprintf("(%s/%s)", orDash(np.Status), np.Desired)
+		}
+		pools = append(pools, pool)
+	}
+	return strings.Join(pools, ",")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+func testClusters(t *testing.T) []scheduler.Cluster {
+	schedule, err := scheduler.ParseSchedule(map[string]string{scheduler.UPTIME_LABEL: "8-19_1-6_x_x"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch, err := scheduler.ParseSchedule(map[string]string{scheduler.UPTIME_LABEL: "0-6_x_x_x"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []scheduler.Cluster{
+		{
+			Name:     "prod",
+			Location: "us-central1",
+			Project:  "demo",
+			Status:   scheduler.STATUS_UP,
+			Schedule: *schedule,
+			Nodes: []scheduler.NodeGroup{
+				{Name: "pool-b", NodeCount: 3},
+				{Name: "pool-a", NodeCount: 2, MinNodeCount: 1, MaxNodeCount: 5, Autoscaling: true},
+				{Name: "pool-c", NodeCount: 1, Schedule: batch},
+			},
+		},
+		{
+			Name:     "dev",
+			Location: "us-central1",
+			Project:  "demo",
+			Schedule: *schedule,
+		},
+	}
+}
+
+func TestWriteClusters(t *testing.T) {
+	now := time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC)
+	want := []Cluster{
+		{
+			Name:           "dev",
+			Location:       "us-central1",
+			Project:        "demo",
+			Schedule:       "8-19_1-6_x_x",
+			Desired:        scheduler.STATUS_UP,
+			NextTransition: &Transition{Time: "2020-04-15T19:00:00Z", Status: scheduler.STATUS_DOWN},
+			NodePools:      []NodePool{},
+		},
+		{
+			Name:           "prod",
+			Location:       "us-central1",
+			Project:        "demo",
+			Status:         scheduler.STATUS_UP,
+			Schedule:       "8-19_1-6_x_x",
+			Desired:        scheduler.STATUS_UP,
+			NextTransition: &Transition{Time: "2020-04-15T19:00:00Z", Status: scheduler.STATUS_DOWN},
+			NodePools: []NodePool{
+				{Name: "pool-a", NodeCount: 2, MinNodeCount: 1, MaxNodeCount: 5, Autoscaling: true},
+				{Name: "pool-b", NodeCount: 3},
+				{Name: "pool-c", NodeCount: 1, Schedule: "0-6_x_x_x", Status: scheduler.STATUS_UP, Desired: scheduler.STATUS_DOWN},
+			},
+		},
+	}
+	wantJSON, _ := json.Marshal(want)
+
+	tests := []struct {
+		format string
+		decode func([]byte, interface{}) error
+	}{
+		{format: FORMAT_JSON, decode: json.Unmarshal},
+		{format: FORMAT_YAML, decode: yaml.Unmarshal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteClusters(&buf, tt.format, testClusters(t), now); err != nil {
+				t.Fatalf("WriteClusters() error = %v", err)
+			}
+			var got []Cluster
+			if err := tt.decode(buf.Bytes(), &got); err != nil {
+				t.Fatalf("failed to decode output: %v", err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			if !bytes.Equal(gotJSON, wantJSON) {
+				t.Errorf("WriteClusters() = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+
+	t.Run(FORMAT_TABLE, func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := WriteClusters(&buf, FORMAT_TABLE, testClusters(t), now); err != nil {
+			t.Fatalf("WriteClusters() error = %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 || !strings.HasPrefix(lines[0], "NAME") || !strings.HasPrefix(lines[1], "dev") {
+			t.Fatalf("WriteClusters() = %q, want header and 2 sorted rows", buf.String())
+		}
+		if !strings.Contains(lines[2], "pool-a=2[1-5],pool-b=3,pool-c=1(up/down)") || !strings.Contains(lines[2], "down at 2020-04-15T19:00:00Z  ") || strings.Contains(lines[2], "(in ") {
+			t.Errorf("WriteClusters() row = %q", lines[2])
+		}
+	})
+
+	if err := WriteClusters(&bytes.Buffer{}, "xml", nil, now); err == nil {
+		t.Error("WriteClusters() with unsupported format, want error")
+	}
+}
+
+func TestWriteClusters_Error(t *testing.T) {
+	now := time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC)
+	clusters := []scheduler.Cluster{{Name: "broken", Location: "us-central1", Err: errors.New("failed to parse cluster schedule")}}
+	out := NewClusters(clusters, now)
+	if len(out) != 1 || out[0].Error != "failed to parse cluster schedule" || out[0].Desired != "" || out[0].NextTransition != nil {
+		t.Errorf("NewClusters() = %+v, want cluster error without desired status", out)
+	}
+	var buf bytes.Buffer
+	if err := WriteClusters(&buf, FORMAT_TABLE, clusters, now); err != nil {
+		t.Fatalf("WriteClusters() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), "error: failed to parse cluster schedule") {
+		t.Errorf("WriteClusters() = %q, want cluster error", buf.String())
+	}
+}
+
+func TestWriteBackups(t *testing.T) {
+	cluster := scheduler.Cluster{Name: "dev", Location: "us-central1", Project: "demo"}
+	cluster.Nodes = []scheduler.NodeGroup{{Name: "pool", NodeCount: 2, MinNodeCount: 1, MaxNodeCount: 5, Autoscaling: true}}
+	latest := scheduler.NewClusterBackup(cluster, time.Date(2020, 4, 16, 19, 0, 0, 0, time.UTC))
+	cluster.Nodes = []scheduler.NodeGroup{{Name: "pool", NodeCount: 3}}
+	first := scheduler.NewClusterBackup(cluster, time.Date(2020, 4, 15, 19, 0, 0, 0, time.UTC))
+
+	var buf bytes.Buffer
+	if err := WriteBackups(&buf, FORMAT_TABLE, []*scheduler.ClusterBackup{latest, first}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("WriteBackups() table = %q, want header and 2 rows", buf.String())
+	}
+	if !strings.Contains(lines[1], "20200415-190000") || !strings.HasSuffix(lines[1], "pool=3") {
+		t.Errorf("WriteBackups() first row = %q, want snapshot 20200415-190000 with pool=3", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "pool=2[1-5]") {
+		t.Errorf("WriteBackups() second row = %q, want pool=2[1-5]", lines[2])
+	}
+
+	buf.Reset()
+	if err := WriteBackups(&buf, FORMAT_JSON, []*scheduler.ClusterBackup{first}); err != nil {
+		t.Fatal(err)
+	}
+	var got []Backup
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Cluster != "demo/us-central1/dev" || got[0].Time != "2020-04-15T19:00:00Z" {
+		t.Errorf("WriteBackups() json = %+v", got)
+	}
+}
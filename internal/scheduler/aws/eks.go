@@ -2,27 +2,80 @@ package aws
 
 import (
 	"context"
-	"fmt"
+	"encoding/base64"
 	log "github.com/sirupsen/logrus"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/defaults"
 	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"github.com/doitintl/cluster-scheduler/internal/scheduler/kube"
 	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	default_UPDATE_TIMEOUT = time.Minute * 15
+	default_UPDATE_CHECK   = time.Second * 15
 )
 
 type EksScheduler struct {
-	eks *eks.Client
+	eks   *eks.Client
+	sts   *sts.Client
+	retry scheduler.RetryPolicy
+	store scheduler.BackupStore
+	// calendars referenced by 'cs-calendar' tag
+	calendars scheduler.Calendars
+	// max time to drain node group nodes before stop; drain is disabled when 0
+	drain time.Duration
+	// node group update status check interval
+	updateCheck time.Duration
+	// Kubernetes API client of cluster
+	kube func(context.Context, scheduler.Cluster) (kubernetes.Interface, error)
 }
 
-func NewEksScheduler(ctx context.Context) (scheduler.Runner, error) {
+// Option configures EksScheduler
+type Option func(*EksScheduler)
+
+// WithBackupStore sets node groups backup store; by default, backups are stored in cluster tags
+func WithBackupStore(store scheduler.BackupStore) Option {
+	return func(e *EksScheduler) {
+		e.store = store
+	}
+}
+
+// WithCalendars sets holiday and blackout calendars referenced by 'cs-calendar' tag
+func WithCalendars(calendars scheduler.Calendars) Option {
+	return func(e *EksScheduler) {
+		e.calendars = calendars
+	}
+}
+
+// WithDrain enables node group drain before stop: cordon nodes and evict pods, respecting PodDisruptionBudgets,
+// waiting up to timeout for pods eviction
+func WithDrain(timeout time.Duration) Option {
+	return func(e *EksScheduler) {
+		e.drain = timeout
+	}
+}
+
+func NewEksScheduler(ctx context.Context, opts ...Option) (scheduler.Runner, error) {
 	cfg, err := external.LoadDefaultAWSConfig()
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to load aws SDK config")
 	}
+	// retries are done by scheduler retry policy only
+	cfg.Retryer = aws.NoOpRetryer{}
 	// Using the Config value, create the EKS client
-	return &EksScheduler{eks.New(cfg)}, nil
+	e := &EksScheduler{eks: eks.New(cfg), sts: sts.New(cfg), retry: scheduler.NewRetryPolicy(isRetryable), store: scheduler.LabelStore{}, updateCheck: default_UPDATE_CHECK}
+	e.kube = e.newKubeClient
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e, nil
 }
 
 func (e EksScheduler) List(ctx context.Context) ([]scheduler.Cluster, error) {
@@ -34,13 +87,23 @@ func (e EksScheduler) List(ctx context.Context) ([]scheduler.Cluster, error) {
 	location := e.eks.Config.Region
 
 	var clusters []scheduler.Cluster
-	req := e.eks.ListClustersRequest(&eks.ListClustersInput{})
-	p := eks.NewListClustersPaginator(req)
-	for p.Next(cx) {
-		page := p.CurrentPage()
+	input := &eks.ListClustersInput{}
+	for {
+		var page *eks.ListClustersResponse
+		err := e.retry.Do(cx, "ListClusters", func() (err error) {
+			page, err = e.eks.ListClustersRequest(input).Send(cx)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list EKS clusters")
+		}
 		// get cluster details
 		for _, name := range page.Clusters {
-			info, err := e.eks.DescribeClusterRequest(&eks.DescribeClusterInput{Name: &name}).Send(cx)
+			var info *eks.DescribeClusterResponse
+			err := e.retry.Do(cx, "DescribeCluster", func() (err error) {
+				info, err = e.eks.DescribeClusterRequest(&eks.DescribeClusterInput{Name: aws.String(name)}).Send(cx)
+				return err
+			})
 			if err != nil {
 				return nil, errors.Wrap(err, "failed to describe cluster")
 			}
@@ -56,40 +119,366 @@ func (e EksScheduler) List(ctx context.Context) ([]scheduler.Cluster, error) {
 				Location: location,
 				Status:   tags[scheduler.STATUS_LABEL],
 				Labels:   tags,
+				ARN:      aws.StringValue(info.Cluster.Arn),
+				Endpoint: aws.StringValue(info.Cluster.Endpoint),
 			}
-			// get cluster uptime - time it is supposed to run
-			uptime, err := scheduler.ParseUptime(tags[scheduler.UPTIME_LABEL])
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to parse cluster uptime range")
+			if err = e.readCluster(cx, info.Cluster, &cluster); err != nil {
+				if cx.Err() != nil {
+					return nil, err
+				}
+				// keep listing other clusters: cluster with error is reported as failed
+				log.WithError(err).WithField("cluster", name).Warn("failed to read cluster")
+				cluster.Err = err
 			}
-			cluster.Uptime = *uptime
-			// scan node groups
-
 			// append cluster
 			log.WithField("cluster", cluster).Debug("listing cluster")
 			clusters = append(clusters, cluster)
 		}
-	}
-	if err := p.Err(); err != nil {
-		return nil, errors.Wrap(err, "failed to list EKS clusters")
+		if page.NextToken == nil {
+			break
+		}
+		input.NextToken = page.NextToken
 	}
 
 	return clusters, nil
 }
 
+// readCluster reads cluster CA certificate, schedule, node groups with their scaling configuration, stop policies and own schedules
+func (e EksScheduler) readCluster(ctx context.Context, info *eks.Cluster, c *scheduler.Cluster) (err error) {
+	if ca := info.CertificateAuthority; ca != nil && ca.Data != nil {
+		if c.CACert, err = base64.StdEncoding.DecodeString(aws.StringValue(ca.Data)); err != nil {
+			return errors.Wrap(err, "failed to decode cluster CA certificate")
+		}
+	}
+	// get cluster schedule - time it is supposed to run
+	schedule, err := scheduler.ParseSchedule(info.Tags, e.calendars)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse cluster schedule")
+	}
+	c.Schedule = *schedule
+	// scan node groups
+	var groupTags map[string]map[string]string
+	c.Nodes, groupTags, err = e.listNodeGroups(ctx, c.Name)
+	if err != nil {
+		return errors.Wrap(err, "failed to list cluster node groups")
+	}
+	// node group stop policy and own schedule
+	if err = c.ParseNodeGroups(groupTags, e.calendars); err != nil {
+		return errors.Wrap(err, "failed to parse node groups")
+	}
+	return nil
+}
+
+// listNodeGroups returns managed node groups with their current scaling configuration, and node group tags
+func (e EksScheduler) listNodeGroups(ctx context.Context, clusterName string) ([]scheduler.NodeGroup, map[string]map[string]string, error) {
+	var groups []scheduler.NodeGroup
+	tags := map[string]map[string]string{}
+	input := &eks.ListNodegroupsInput{ClusterName: aws.String(clusterName)}
+	for {
+		var page *eks.ListNodegroupsResponse
+		err := e.retry.Do(ctx, "ListNodegroups", func() (err error) {
+			page, err = e.eks.ListNodegroupsRequest(input).Send(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to list node groups")
+		}
+		for _, name := range page.Nodegroups {
+			var info *eks.DescribeNodegroupResponse
+			err := e.retry.Do(ctx, "DescribeNodegroup", func() (err error) {
+				info, err = e.eks.DescribeNodegroupRequest(&eks.DescribeNodegroupInput{
+					ClusterName:   aws.String(clusterName),
+					NodegroupName: aws.String(name),
+				}).Send(ctx)
+				return err
+			})
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "failed to describe node group")
+			}
+			group := scheduler.NodeGroup{Name: name}
+			if sc := info.Nodegroup.ScalingConfig; sc != nil {
+				group.NodeCount = int32(aws.Int64Value(sc.DesiredSize))
+				group.MinNodeCount = int32(aws.Int64Value(sc.MinSize))
+				group.MaxNodeCount = int32(aws.Int64Value(sc.MaxSize))
+				// managed node group can be scaled by cluster autoscaler within min-max range
+				group.Autoscaling = group.MinNodeCount != group.MaxNodeCount
+			}
+			tags[name] = info.Nodegroup.Tags
+			groups = append(groups, group)
+		}
+		if page.NextToken == nil {
+			break
+		}
+		input.NextToken = page.NextToken
+	}
+	return groups, tags, nil
+}
+
+// Stop node groups: backup scaling configuration as cluster tags and scale to 0
 func (e EksScheduler) Stop(ctx context.Context, cluster scheduler.Cluster) error {
-	panic("implement me")
+	log.WithFields(log.Fields{
+		"cluster":  cluster.Name,
+		"location": cluster.Location,
+		"status":   cluster.Status,
+	}).Info("stopping cluster")
+	// check cluster and node groups status
+	if _, ok := cluster.Transition(scheduler.STATUS_DOWN); !ok {
+		log.Debug("ignore stopped cluster")
+		return nil
+	}
+	plan, err := e.PlanStop(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return e.apply(ctx, plan)
 }
 
-func (e EksScheduler) Restart(ctx context.Context, cluster scheduler.Cluster) error {
-	panic("implement me")
+// PlanStop plans node groups stop: backup scaling configuration in backup store (cluster tags by default),
+// then scale node groups to 0 or to number of nodes to keep, keeping max size (must be at least 1);
+// node groups scaled to 0 are drained first, if enabled; skipped node groups are left as is; already stopped node groups are ignored
+func (e EksScheduler) PlanStop(_ context.Context, cluster scheduler.Cluster) (*scheduler.Plan, error) {
+	cluster, ok := cluster.Transition(scheduler.STATUS_DOWN)
+	plan := &scheduler.Plan{Cluster: cluster, Status: scheduler.STATUS_DOWN}
+	if !ok {
+		return plan, nil
+	}
+	tags, err := scheduler.PlanBackup(plan, e.store, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to backup node groups")
+	}
+	for k, v := range cluster.StatusLabels(scheduler.STATUS_DOWN) {
+		tags[k] = v
+	}
+	plan.Add(scheduler.Operation{Type: scheduler.OP_SET_LABELS, Labels: tags})
+	for _, ng := range cluster.StoppedNodeGroups() {
+		size, _ := ng.StopSize()
+		if e.drain > 0 && size == 0 {
+			plan.Add(scheduler.Operation{Type: scheduler.OP_DRAIN, NodeGroup: ng.Name})
+		}
+		plan.Add(scheduler.Operation{
+			Type:         scheduler.OP_SET_SCALING,
+			NodeGroup:    ng.Name,
+			NodeCount:    size,
+			MinNodeCount: size,
+			MaxNodeCount: ng.MaxNodeCount,
+		})
+	}
+	return plan, nil
 }
 
-func (e EksScheduler) DecideOnStatus(cluster scheduler.Cluster) error {
-	if cluster.Uptime.IsInRange(time.Now()) {
-		fmt.Println("пусть себе бежит...")
+// Restart node groups: restore scaling configuration from cluster tags
+func (e EksScheduler) Restart(ctx context.Context, cluster scheduler.Cluster) error {
+	log.WithFields(log.Fields{
+		"cluster":  cluster.Name,
+		"location": cluster.Location,
+		"status":   cluster.Status,
+	}).Info("restarting cluster")
+	// check cluster and node groups status
+	if _, ok := cluster.Transition(scheduler.STATUS_UP); !ok {
+		log.Debug("ignore already running cluster")
 		return nil
 	}
-	fmt.Println("убить нах!")
+	plan, err := e.PlanRestart(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return e.apply(ctx, plan)
+}
+
+// PlanRestart plans restart of stopped node groups from the latest backup
+func (e EksScheduler) PlanRestart(ctx context.Context, cluster scheduler.Cluster) (*scheduler.Plan, error) {
+	stopped, ok := cluster.Transition(scheduler.STATUS_UP)
+	if !ok {
+		return &scheduler.Plan{Cluster: cluster, Status: scheduler.STATUS_UP}, nil
+	}
+	return e.PlanRestore(ctx, stopped, "")
+}
+
+// Restore node groups to backup snapshot
+func (e EksScheduler) Restore(ctx context.Context, cluster scheduler.Cluster, snapshot string) error {
+	log.WithFields(log.Fields{
+		"cluster":  cluster.Name,
+		"location": cluster.Location,
+		"status":   cluster.Status,
+		"snapshot": snapshot,
+	}).Info("restoring cluster")
+	plan, err := e.PlanRestore(ctx, cluster, snapshot)
+	if err != nil {
+		return err
+	}
+	return e.apply(ctx, plan)
+}
+
+// PlanRestore plans node groups restore: restore scaling configuration from backup snapshot,
+// then update cluster scheduler status tags
+func (e EksScheduler) PlanRestore(ctx context.Context, cluster scheduler.Cluster, snapshot string) (*scheduler.Plan, error) {
+	plan := &scheduler.Plan{Cluster: cluster, Status: scheduler.STATUS_UP}
+	groups := cluster.StoppedNodeGroups()
+	var backup *scheduler.ClusterBackup
+	if len(groups) > 0 {
+		var err error
+		if backup, err = scheduler.LoadBackup(ctx, e.store, cluster, snapshot); err != nil {
+			return nil, errors.Wrap(err, "failed to load node groups backup")
+		}
+	}
+	for _, ng := range groups {
+		upNodeGroup, err := backup.NodeGroup(ng.Name)
+		if err != nil {
+			return nil, err
+		}
+		plan.Add(scheduler.Operation{
+			Type:         scheduler.OP_SET_SCALING,
+			NodeGroup:    ng.Name,
+			NodeCount:    upNodeGroup.NodeCount,
+			MinNodeCount: upNodeGroup.MinNodeCount,
+			MaxNodeCount: upNodeGroup.MaxNodeCount,
+		})
+	}
+	plan.Add(scheduler.Operation{
+		Type:   scheduler.OP_SET_LABELS,
+		Labels: cluster.StatusLabels(scheduler.STATUS_UP),
+	})
+	return plan, nil
+}
+
+// apply executes planned operations one by one, waiting for node group updates to complete
+func (e EksScheduler) apply(ctx context.Context, plan *scheduler.Plan) error {
+	cluster := plan.Cluster
+	for _, op := range plan.Operations {
+		logger := log.WithFields(log.Fields{
+			"cluster":    cluster.Name,
+			"node-group": op.NodeGroup,
+		})
+		switch op.Type {
+		case scheduler.OP_SAVE_BACKUP:
+			logger.Debug("saving node groups backup")
+			if err := e.store.Save(ctx, op.Backup); err != nil {
+				return errors.Wrap(err, "failed to save node groups backup")
+			}
+		case scheduler.OP_DRAIN:
+			logger.Debug("draining node group")
+			// drain is best effort: node group is stopped anyway
+			if err := e.drainNodeGroup(ctx, cluster, op.NodeGroup); err != nil {
+				logger.WithError(err).Warn("failed to drain node group")
+			}
+		case scheduler.OP_SET_LABELS:
+			logger.Debug("updating cluster scheduler tags")
+			if err := e.tagCluster(ctx, cluster, op.Labels); err != nil {
+				return errors.Wrap(err, "failed to update cluster tags")
+			}
+		case scheduler.OP_SET_SCALING:
+			logger.WithField("size", op.NodeCount).Debug("resizing node group")
+			err := e.updateNodeGroupScaling(ctx, cluster.Name, op.NodeGroup,
+				int64(op.MinNodeCount), int64(op.NodeCount), int64(op.MaxNodeCount))
+			if err != nil {
+				return scheduler.NodeGroupFailure(op.NodeGroup, errors.Wrapf(err, "failed to set node group size to %d", op.NodeCount))
+			}
+		default:
+			return errors.Errorf("unsupported operation '%s'", op.Type)
+		}
+	}
+	return nil
+}
+
+// drainNodeGroup cordons node group nodes and evicts their pods
+func (e EksScheduler) drainNodeGroup(ctx context.Context, cluster scheduler.Cluster, name string) error {
+	client, err := e.kube(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	drainer := &kube.Drainer{Client: client, Timeout: e.drain}
+	return drainer.Drain(ctx, kube.EKS_NODE_GROUP_LABEL+"="+name)
+}
+
+// Protected returns protected workloads (running Jobs and keep-alive pods) on cluster node groups to stop
+func (e EksScheduler) Protected(ctx context.Context, cluster scheduler.Cluster) ([]string, error) {
+	groups := cluster.StoppedNodeGroups()
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	client, err := e.kube(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return kube.ProtectedWorkloads(ctx, client, kube.NodeGroupSelector(kube.EKS_NODE_GROUP_LABEL, groups))
+}
+
+// newKubeClient returns Kubernetes API client of EKS cluster, authenticated with current AWS identity
+func (e EksScheduler) newKubeClient(_ context.Context, cluster scheduler.Cluster) (kubernetes.Interface, error) {
+	return kube.NewClient(cluster.Endpoint, cluster.CACert, eksTokenSource{sts: e.sts, cluster: cluster.Name})
+}
+
+func (e EksScheduler) tagCluster(ctx context.Context, cluster scheduler.Cluster, tags map[string]string) error {
+	return e.retry.Do(ctx, "TagResource", func() error {
+		_, err := e.eks.TagResourceRequest(&eks.TagResourceInput{
+			ResourceArn: aws.String(cluster.ARN),
+			Tags:        tags,
+		}).Send(ctx)
+		return err
+	})
+}
+
+func (e EksScheduler) updateNodeGroupScaling(ctx context.Context, clusterName, name string, min, desired, max int64) error {
+	var resp *eks.UpdateNodegroupConfigResponse
+	err := e.retry.Do(ctx, "UpdateNodegroupConfig", func() (err error) {
+		req := e.eks.UpdateNodegroupConfigRequest(&eks.UpdateNodegroupConfigInput{
+			ClusterName:   aws.String(clusterName),
+			NodegroupName: aws.String(name),
+			ScalingConfig: &eks.NodegroupScalingConfig{
+				MinSize:     aws.Int64(min),
+				DesiredSize: aws.Int64(desired),
+				MaxSize:     aws.Int64(max),
+			},
+		})
+		// EKS accepts 0 min and desired size, but SDK model validation still requires 1
+		req.Handlers.Validate.Remove(defaults.ValidateParametersHandler)
+		resp, err = req.Send(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return e.waitForUpdate(ctx, clusterName, name, resp.Update)
+}
+
+func (e EksScheduler) waitForUpdate(ctx context.Context, clusterName, name string, update *eks.Update) error {
+	timeout := time.NewTimer(default_UPDATE_TIMEOUT)
+	defer timeout.Stop()
+	ticker := time.NewTicker(e.updateCheck)
+	defer ticker.Stop()
+	for update != nil {
+		switch update.Status {
+		case eks.UpdateStatusSuccessful:
+			log.WithField("update", aws.StringValue(update.Id)).Debug("successfully completed update")
+			return nil
+		case eks.UpdateStatusFailed, eks.UpdateStatusCancelled:
+			var msg string
+			if len(update.Errors) > 0 {
+				msg = aws.StringValue(update.Errors[0].ErrorMessage)
+			}
+			return errors.Errorf("node group update %s: %s %s", aws.StringValue(update.Id), update.Status, msg)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return errors.Errorf("timeout waiting for node group update %s", aws.StringValue(update.Id))
+		case <-ticker.C:
+		}
+		log.WithField("update", aws.StringValue(update.Id)).Debug("get update status")
+		var resp *eks.DescribeUpdateResponse
+		err := e.retry.Do(ctx, "DescribeUpdate", func() (err error) {
+			resp, err = e.eks.DescribeUpdateRequest(&eks.DescribeUpdateInput{
+				Name:          aws.String(clusterName),
+				NodegroupName: aws.String(name),
+				UpdateId:      update.Id,
+			}).Send(ctx)
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get update")
+		}
+		update = resp.Update
+	}
 	return nil
 }
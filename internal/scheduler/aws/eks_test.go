@@ -0,0 +1,332 @@
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/defaults"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+)
+
+type fakeScaling struct {
+	MinSize     int64 `json:"minSize"`
+	DesiredSize int64 `json:"desiredSize"`
+	MaxSize     int64 `json:"maxSize"`
+}
+
+type fakeCluster struct {
+	arn        string
+	tags       map[string]string
+	nodeGroups map[string]*fakeScaling
+}
+
+// fakeEks is a minimal in-memory stand-in for the EKS REST API
+type fakeEks struct {
+	sync.Mutex
+	clusters map[string]*fakeCluster
+	// number of requests to fail with throttling error
+	throttle int
+	requests int
+	// node group update statuses, returned by UpdateNodegroupConfig then by each DescribeUpdate; Successful when empty
+	updates   []string
+	describes int
+}
+
+// update returns next node group update status
+func (f *fakeEks) update() map[string]interface{} {
+	status := "Successful"
+	if len(f.updates) > 0 {
+		status, f.updates = f.updates[0], f.updates[1:]
+	}
+	update := map[string]interface{}{"id": "update-1", "status": status}
+	if status == "Failed" {
+		update["errors"] = []map[string]interface{}{{"errorCode": "AsgInstanceLaunchFailures", "errorMessage": "insufficient capacity"}}
+	}
+	return map[string]interface{}{"update": update}
+}
+
+func (f *fakeEks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	f.requests++
+	if f.throttle > 0 {
+		f.throttle--
+		w.Header().Set("X-Amzn-Errortype", "ThrottlingException")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"message":"Rate exceeded"}`))
+		return
+	}
+	var resp interface{}
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case path[0] == "tags" && r.Method == http.MethodPost:
+		arn := strings.TrimPrefix(r.URL.Path, "/tags/")
+		var in struct {
+			Tags map[string]string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, c := range f.clusters {
+			if c.arn == arn {
+				for k, v := range in.Tags {
+					c.tags[k] = v
+				}
+			}
+		}
+		resp = struct{}{}
+	case path[0] == "tags" && r.Method == http.MethodDelete:
+		arn := strings.TrimPrefix(r.URL.Path, "/tags/")
+		for _, c := range f.clusters {
+			if c.arn == arn {
+				for _, k := range r.URL.Query()["tagKeys"] {
+					delete(c.tags, k)
+				}
+			}
+		}
+		resp = struct{}{}
+	case len(path) == 1 && path[0] == "clusters":
+		var names []string
+		for name := range f.clusters {
+			names = append(names, name)
+		}
+		resp = map[string]interface{}{"clusters": names}
+	case len(path) == 2:
+		c := f.clusters[path[1]]
+		resp = map[string]interface{}{"cluster": map[string]interface{}{
+			"name": path[1], "arn": c.arn, "tags": c.tags,
+		}}
+	case len(path) == 3:
+		var names []string
+		for name := range f.clusters[path[1]].nodeGroups {
+			names = append(names, name)
+		}
+		resp = map[string]interface{}{"nodegroups": names}
+	case len(path) == 4 && path[2] == "updates":
+		if path[3] != "update-1" || r.URL.Query().Get("nodegroupName") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		f.describes++
+		resp = f.update()
+	case len(path) == 4:
+		resp = map[string]interface{}{"nodegroup": map[string]interface{}{
+			"nodegroupName": path[3], "scalingConfig": f.clusters[path[1]].nodeGroups[path[3]],
+		}}
+	case len(path) == 5 && path[4] == "update-config":
+		var in struct {
+			ScalingConfig fakeScaling `json:"scalingConfig"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*f.clusters[path[1]].nodeGroups[path[3]] = in.ScalingConfig
+		resp = f.update()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func newTestScheduler(t *testing.T, f *fakeEks) EksScheduler {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	cfg := defaults.Config()
+	cfg.Region = "us-east-1"
+	cfg.Credentials = aws.NewStaticCredentialsProvider("AKID", "SECRET", "")
+	cfg.EndpointResolver = aws.ResolveWithEndpointURL(srv.URL)
+	// test scheduler retry policy only
+	cfg.Retryer = aws.NoOpRetryer{}
+	return EksScheduler{
+		eks:   eks.New(cfg),
+		retry: scheduler.RetryPolicy{Attempts: 3, Delay: time.Millisecond, Retryable: isRetryable},
+		store: scheduler.LabelStore{},
+		// do not wait for node group updates
+		updateCheck: time.Millisecond,
+	}
+}
+
+func TestEksScheduler_StopRestart(t *testing.T) {
+	f := &fakeEks{clusters: map[string]*fakeCluster{
+		"dev": {
+			arn: "arn:aws:eks:us-east-1:123456789012:cluster/dev",
+			tags: map[string]string{
+				scheduler.ENABLED_LABEL: "true",
+				scheduler.UPTIME_LABEL:  "8-19_1-5_x_x",
+			},
+			nodeGroups: map[string]*fakeScaling{
+				"workers": {MinSize: 1, DesiredSize: 3, MaxSize: 5},
+			},
+		},
+		"prod": {
+			arn:        "arn:aws:eks:us-east-1:123456789012:cluster/prod",
+			tags:       map[string]string{},
+			nodeGroups: map[string]*fakeScaling{"workers": {MinSize: 3, DesiredSize: 3, MaxSize: 3}},
+		},
+	}}
+	e := newTestScheduler(t, f)
+	ctx := context.Background()
+
+	clusters, err := e.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(clusters) != 1 || clusters[0].Name != "dev" {
+		t.Fatalf("List() = %v, want only 'dev' cluster", clusters)
+	}
+	want := scheduler.NodeGroup{Name: "workers", NodeCount: 3, MinNodeCount: 1, MaxNodeCount: 5, Autoscaling: true}
+	if len(clusters[0].Nodes) != 1 || !reflect.DeepEqual(clusters[0].Nodes[0], want) {
+		t.Fatalf("List() nodes = %v, want %v", clusters[0].Nodes, want)
+	}
+
+	// stop: backup in tags and scale to 0
+	if err = e.Stop(ctx, clusters[0]); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	dev := f.clusters["dev"]
+	if got := *dev.nodeGroups["workers"]; got != (fakeScaling{0, 0, 5}) {
+		t.Errorf("Stop() scaling = %v, want 0/0/5", got)
+	}
+	if got := dev.tags[scheduler.STATUS_LABEL]; got != scheduler.STATUS_DOWN {
+		t.Errorf("Stop() status tag = %q, want %q", got, scheduler.STATUS_DOWN)
+	}
+	backup, err := scheduler.LoadBackup(ctx, scheduler.LabelStore{}, scheduler.Cluster{Labels: dev.tags, Nodes: []scheduler.NodeGroup{want}}, "")
+	if err != nil {
+		t.Fatalf("Stop() backup tag error = %v", err)
+	}
+	if got, _ := backup.NodeGroup("workers"); !reflect.DeepEqual(*got, want) {
+		t.Errorf("Stop() backup tag = %v, want %v", got, want)
+	}
+
+	// restart: restore scaling from tags
+	clusters, err = e.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if err = e.Restart(ctx, clusters[0]); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if got := *dev.nodeGroups["workers"]; got != (fakeScaling{1, 3, 5}) {
+		t.Errorf("Restart() scaling = %v, want 1/3/5", got)
+	}
+	if got := dev.tags[scheduler.STATUS_LABEL]; got != scheduler.STATUS_UP {
+		t.Errorf("Restart() status tag = %q, want %q", got, scheduler.STATUS_UP)
+	}
+}
+
+func TestEksScheduler_Retry(t *testing.T) {
+	tests := []struct {
+		name     string
+		throttle int
+		wantErr  bool
+		requests int
+	}{
+		{name: "no errors", requests: 2},
+		{name: "retry throttled requests", throttle: 2, requests: 4},
+		{name: "give up after max attempts", throttle: 3, wantErr: true, requests: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeEks{throttle: tt.throttle, clusters: map[string]*fakeCluster{
+				"dev": {arn: "arn:aws:eks:us-east-1:123456789012:cluster/dev", tags: map[string]string{}},
+			}}
+			e := newTestScheduler(t, f)
+			_, err := e.List(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("List() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if f.requests != tt.requests {
+				t.Errorf("List() requests = %d, want %d", f.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestEksScheduler_WaitForUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		updates   []string
+		wantErr   string
+		describes int
+	}{
+		{name: "completed update", updates: []string{"Successful"}},
+		{name: "in progress update", updates: []string{"InProgress", "InProgress", "Successful"}, describes: 2},
+		{name: "failed update", updates: []string{"InProgress", "Failed"}, wantErr: "Failed insufficient capacity", describes: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeEks{updates: tt.updates, clusters: map[string]*fakeCluster{
+				"dev": {
+					arn:        "arn:aws:eks:us-east-1:123456789012:cluster/dev",
+					tags:       map[string]string{},
+					nodeGroups: map[string]*fakeScaling{"workers": {MinSize: 1, DesiredSize: 3, MaxSize: 5}},
+				},
+			}}
+			e := newTestScheduler(t, f)
+			err := e.updateNodeGroupScaling(context.Background(), "dev", "workers", 0, 0, 5)
+			if (err != nil) != (tt.wantErr != "") || err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("updateNodeGroupScaling() error = %v, want %q", err, tt.wantErr)
+			}
+			if f.describes != tt.describes {
+				t.Errorf("updateNodeGroupScaling() DescribeUpdate requests = %d, want %d", f.describes, tt.describes)
+			}
+		})
+	}
+}
+
+func TestEksScheduler_PlanStop(t *testing.T) {
+	e := EksScheduler{store: scheduler.LabelStore{}}
+	cluster := scheduler.Cluster{
+		Name:  "dev",
+		Nodes: []scheduler.NodeGroup{{Name: "workers", NodeCount: 3, MinNodeCount: 1, MaxNodeCount: 5, Autoscaling: true}},
+	}
+	plan, err := e.PlanStop(context.Background(), cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Operations) != 2 {
+		t.Fatalf("PlanStop() = %v, want 2 operations", plan.Operations)
+	}
+	if got, err := scheduler.ParseBackupLabels("workers", plan.Operations[0].Labels); err != nil || got.NodeCount != 3 || got.MaxNodeCount != 5 {
+		t.Errorf("PlanStop() backup = %v (error %v), want 3 nodes", got, err)
+	}
+	if got := plan.Operations[1]; got.Type != scheduler.OP_SET_SCALING || got.NodeCount != 0 || got.MaxNodeCount != 5 {
+		t.Errorf("PlanStop() scaling = %v, want 0/0/5", got)
+	}
+
+	// keep nodes of system node group, skip ingress node group
+	cluster.Labels = map[string]string{"cs-keep-system": "1", "cs-keep-ingress": scheduler.KEEP_SKIP}
+	cluster.Nodes = append(cluster.Nodes,
+		scheduler.NodeGroup{Name: "system", NodeCount: 2, MinNodeCount: 2, MaxNodeCount: 2},
+		scheduler.NodeGroup{Name: "ingress", NodeCount: 2, MinNodeCount: 2, MaxNodeCount: 2},
+	)
+	if err = cluster.ParseStopPolicies(); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = e.PlanStop(context.Background(), cluster); err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Operations) != 3 {
+		t.Fatalf("PlanStop() with stop policies = %v, want 3 operations", plan.Operations)
+	}
+	if got := plan.Operations[2]; got.NodeGroup != "system" || got.NodeCount != 1 || got.MinNodeCount != 1 || got.MaxNodeCount != 2 {
+		t.Errorf("PlanStop() system scaling = %v, want 1/1/2", got)
+	}
+	cluster.Status = scheduler.STATUS_DOWN
+	if plan, _ = e.PlanStop(context.Background(), cluster); len(plan.Operations) != 0 {
+		t.Errorf("PlanStop() for stopped cluster = %v, want no operations", plan.Operations)
+	}
+}
@@ -0,0 +1,29 @@
+package aws
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/pkg/errors"
+)
+
+// isRetryable classifies transient EKS API errors
+func isRetryable(err error) bool {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	switch aerr.Code() {
+	case "ThrottlingException", "TooManyRequestsException", "RequestLimitExceeded",
+		eks.ErrCodeServerException, eks.ErrCodeServiceUnavailableException,
+		// node group update is already in progress
+		eks.ErrCodeResourceInUseException:
+		return true
+	}
+	var rerr awserr.RequestFailure
+	if errors.As(err, &rerr) {
+		return rerr.StatusCode() == http.StatusTooManyRequests || rerr.StatusCode() >= http.StatusInternalServerError
+	}
+	return false
+}
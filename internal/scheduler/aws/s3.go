@@ -0,0 +1,99 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/aws/external"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"github.com/pkg/errors"
+)
+
+// S3Client reads and writes backup objects in S3 bucket
+type S3Client struct {
+	s3     *s3.Client
+	bucket string
+	retry  scheduler.RetryPolicy
+}
+
+// NewS3Client returns S3 bucket client, using default AWS config
+func NewS3Client(bucket string) (*S3Client, error) {
+	cfg, err := external.LoadDefaultAWSConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load aws SDK config")
+	}
+	// retries are done by scheduler retry policy only
+	cfg.Retryer = aws.NoOpRetryer{}
+	return &S3Client{s3: s3.New(cfg), bucket: bucket, retry: scheduler.NewRetryPolicy(isRetryable)}, nil
+}
+
+// Put creates or overwrites object
+func (c *S3Client) Put(ctx context.Context, key string, data []byte) error {
+	return c.retry.Do(ctx, "PutObject", func() error {
+		_, err := c.s3.PutObjectRequest(&s3.PutObjectInput{
+			Bucket:      aws.String(c.bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String("application/json"),
+		}).Send(ctx)
+		return err
+	})
+}
+
+// Get returns object data; scheduler.ErrObjectNotFound if object does not exist
+func (c *S3Client) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := c.retry.Do(ctx, "GetObject", func() error {
+		resp, err := c.s3.GetObjectRequest(&s3.GetObjectInput{
+			Bucket: aws.String(c.bucket),
+			Key:    aws.String(key),
+		}).Send(ctx)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, err = ioutil.ReadAll(resp.Body)
+		return err
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, scheduler.ErrObjectNotFound
+	}
+	var rerr awserr.RequestFailure
+	if errors.As(err, &rerr) && rerr.StatusCode() == http.StatusNotFound {
+		return nil, scheduler.ErrObjectNotFound
+	}
+	return data, err
+}
+
+// List returns keys of objects with prefix
+func (c *S3Client) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	var token *string
+	for {
+		var resp *s3.ListObjectsV2Response
+		err := c.retry.Do(ctx, "ListObjectsV2", func() (err error) {
+			resp, err = c.s3.ListObjectsV2Request(&s3.ListObjectsV2Input{
+				Bucket:            aws.String(c.bucket),
+				Prefix:            aws.String(prefix),
+				ContinuationToken: token,
+			}).Send(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range resp.Contents {
+			keys = append(keys, aws.StringValue(o.Key))
+		}
+		if !aws.BoolValue(resp.IsTruncated) {
+			return keys, nil
+		}
+		token = resp.NextContinuationToken
+	}
+}
@@ -0,0 +1,118 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/defaults"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+)
+
+// fakeS3 is a minimal in-memory stand-in for the S3 REST API (path style)
+type fakeS3 struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = data
+	case http.MethodGet:
+		if r.URL.Query().Get("list-type") == "2" {
+			var buf bytes.Buffer
+			buf.WriteString(`<ListBucketResult><IsTruncated>false</IsTruncated>`)
+			for key := range f.objects {
+				name := strings.TrimPrefix(key, r.URL.Path+"/")
+				if name != key && strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+					fmt.Fprintf(&buf, "<Contents><Key>%s</Key></Contents>", name)
+				}
+			}
+			buf.WriteString(`</ListBucketResult>`)
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = w.Write(buf.Bytes())
+			return
+		}
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		http.Error(w, "unsupported method", http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3Client(t *testing.T) {
+	f := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	cfg := defaults.Config()
+	cfg.Region = "us-east-1"
+	cfg.Credentials = aws.NewStaticCredentialsProvider("AKID", "SECRET", "")
+	cfg.EndpointResolver = aws.ResolveWithEndpointURL(srv.URL)
+	cfg.Retryer = aws.NoOpRetryer{}
+	client := s3.New(cfg)
+	client.ForcePathStyle = true
+	store := scheduler.ObjectStore{
+		Client: &S3Client{s3: client, bucket: "backups", retry: scheduler.RetryPolicy{Attempts: 1, Retryable: isRetryable}},
+		Prefix: "cluster-scheduler",
+	}
+	ctx := context.Background()
+	cluster := scheduler.Cluster{
+		Name:     "dev",
+		Location: "us-east-1",
+		Nodes:    []scheduler.NodeGroup{{Name: "workers", NodeCount: 3, MinNodeCount: 1, MaxNodeCount: 5, Autoscaling: true}},
+	}
+
+	if _, err := scheduler.LoadBackup(ctx, store, cluster, ""); err != scheduler.ErrBackupNotFound {
+		t.Fatalf("LoadBackup() error = %v, want %v", err, scheduler.ErrBackupNotFound)
+	}
+	first := scheduler.NewClusterBackup(cluster, time.Date(2020, 4, 15, 19, 0, 0, 0, time.UTC))
+	cluster.Nodes[0].NodeCount = 5
+	latest := scheduler.NewClusterBackup(cluster, time.Date(2020, 4, 16, 19, 0, 0, 0, time.UTC))
+	for _, b := range []*scheduler.ClusterBackup{latest, first} {
+		if err := store.Save(ctx, b); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if _, ok := f.objects["/backups/cluster-scheduler/"+cluster.ID()+"/20200415-190000.json"]; !ok {
+		t.Errorf("Save() objects = %v, want snapshot 20200415-190000 of cluster %s", f.objects, cluster.ID())
+	}
+	backups, err := store.List(ctx, cluster)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(backups) != 2 || backups[0].Snapshot() != first.Snapshot() || backups[1].Snapshot() != latest.Snapshot() {
+		t.Errorf("List() = %v, want snapshots %s, %s", backups, first.Snapshot(), latest.Snapshot())
+	}
+	for snapshot, want := range map[string]int32{"": 5, first.Snapshot(): 3} {
+		backup, err := scheduler.LoadBackup(ctx, store, cluster, snapshot)
+		if err != nil {
+			t.Fatalf("LoadBackup(%q) error = %v", snapshot, err)
+		}
+		if got, err := backup.NodeGroup("workers"); err != nil || got.NodeCount != want {
+			t.Errorf("LoadBackup(%q) node group = %v (error %v), want %d nodes", snapshot, got, err, want)
+		}
+	}
+}
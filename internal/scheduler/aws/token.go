@@ -0,0 +1,38 @@
+package aws
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// EKS Kubernetes API token: presigned STS GetCallerIdentity URL, as generated by aws-iam-authenticator
+	token_PREFIX      = "k8s-aws-v1."
+	cluster_ID_HEADER = "x-k8s-aws-id"
+	// presigned URL is valid for 15 minutes; refresh token a bit earlier
+	token_PRESIGN    = time.Minute
+	token_EXPIRATION = 14 * time.Minute
+)
+
+// eksTokenSource returns Kubernetes API bearer tokens of EKS cluster for current AWS identity
+type eksTokenSource struct {
+	sts     *sts.Client
+	cluster string
+}
+
+func (ts eksTokenSource) Token() (*oauth2.Token, error) {
+	req := ts.sts.GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	req.HTTPRequest.Header.Add(cluster_ID_HEADER, ts.cluster)
+	url, err := req.Presign(token_PRESIGN)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to presign STS request")
+	}
+	return &oauth2.Token{
+		AccessToken: token_PREFIX + base64.RawURLEncoding.EncodeToString([]byte(url)),
+		Expiry:      time.Now().Add(token_EXPIRATION),
+	}, nil
+}
@@ -2,6 +2,10 @@ package scheduler
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -9,35 +13,126 @@ import (
 const (
 	name_FORMAT   = "cs-%s-size"
 	backup_FORMAT = "%t_%d_%d_%d"
+	// BACKUP_VERSION is a version of structured node group backup record
+	BACKUP_VERSION = 2
+	// max label value length (GKE label values are limited to 63 characters)
+	label_VALUE_LENGTH = 63
 )
 
-type NodesBackup struct {
-	Name  string
-	Value string
+// NodeGroupBackup is a versioned node group configuration backup record
+type NodeGroupBackup struct {
+	Version int       `json:"version"`
+	Time    time.Time `json:"time"`
+	// Autoscaling, MinNodeCount and MaxNodeCount are autoscaling configuration (per zone for GKE node pools)
+	Autoscaling  bool  `json:"autoscaling"`
+	MinNodeCount int32 `json:"minNodeCount"`
+	MaxNodeCount int32 `json:"maxNodeCount"`
+	// NodeCount is current node count (per zone for GKE node pools)
+	NodeCount int32 `json:"nodeCount"`
+	// Zones is current node count per zone
+	Zones map[string]int32 `json:"zones,omitempty"`
 }
 
-func Backup(ng NodeGroup) NodesBackup {
-	name := fmt.Sprintf(name_FORMAT, ng.Name)
-	backup := fmt.Sprintf(backup_FORMAT, ng.Autoscaling, ng.NodeCount, ng.MinNodeCount, ng.MaxNodeCount)
-	return NodesBackup{name, backup}
+// NewBackup returns backup record of node group configuration at time t
+func NewBackup(ng NodeGroup, t time.Time) *NodeGroupBackup {
+	return &NodeGroupBackup{
+		Version:      BACKUP_VERSION,
+		Time:         t.UTC().Truncate(time.Second),
+		Autoscaling:  ng.Autoscaling,
+		MinNodeCount: ng.MinNodeCount,
+		MaxNodeCount: ng.MaxNodeCount,
+		NodeCount:    ng.NodeCount,
+		Zones:        ng.Zones,
+	}
+}
+
+// NodeGroup returns node group configuration to restore
+func (b *NodeGroupBackup) NodeGroup(name string) *NodeGroup {
+	return &NodeGroup{
+		Name:         name,
+		NodeCount:    b.NodeCount,
+		MinNodeCount: b.MinNodeCount,
+		MaxNodeCount: b.MaxNodeCount,
+		Autoscaling:  b.Autoscaling,
+		Zones:        b.Zones,
+	}
 }
 
+// GetBackupLabel returns name of backup label of node group
 func GetBackupLabel(name string) string {
 	return fmt.Sprintf(name_FORMAT, name)
 }
 
-func Restore(name, backup string) (*NodeGroup, error) {
-	var autoscaling bool
-	var count, min, max int32
-	_, err := fmt.Sscanf(backup, backup_FORMAT, &autoscaling, &count, &min, &max)
+// zoneSuffix returns zone name without region: 'b' for 'europe-west1-b'
+func zoneSuffix(zone string) string {
+	return zone[strings.LastIndex(zone, "-")+1:]
+}
+
+// BackupLabel encodes node group backup record as a single label value:
+// 'v<version>_<autoscaling>_<count>_<min>_<max>_<time>[_<zone>-<count>...]', where time is Unix time in base 36
+// and zone is zone name without region (e.g. 'b' for 'europe-west1-b')
+func BackupLabel(b *NodeGroupBackup) (string, error) {
+	parts := []string{
+		fmt.Sprintf("v%d", b.Version),
+		fmt.Sprintf(backup_FORMAT, b.Autoscaling, b.NodeCount, b.MinNodeCount, b.MaxNodeCount),
+		strconv.FormatInt(b.Time.Unix(), 36),
+	}
+	zones := make([]string, 0, len(b.Zones))
+	for zone, count := range b.Zones {
+		zones = append(zones, fmt.Sprintf("%s-%d", zoneSuffix(zone), count))
+	}
+	sort.Strings(zones)
+	value := strings.Join(append(parts, zones...), "_")
+	if len(value) > label_VALUE_LENGTH {
+		return "", errors.Errorf("backup label value '%s' is longer than %d characters", value, label_VALUE_LENGTH)
+	}
+	return value, nil
+}
+
+// ParseBackupLabels reads node group backup record from 'cs-<name>-size' label; supports legacy '%t_%d_%d_%d' format.
+// Zones are named without region, as in label value.
+func ParseBackupLabels(name string, labels map[string]string) (*NodeGroupBackup, error) {
+	value, ok := labels[GetBackupLabel(name)]
+	if !ok {
+		return nil, errors.Errorf("missing backup label %s", GetBackupLabel(name))
+	}
+	b := &NodeGroupBackup{Version: 1}
+	// legacy format: autoscaling_count_min_max
+	if !strings.HasPrefix(value, "v") {
+		if _, err := fmt.Sscanf(value, backup_FORMAT, &b.Autoscaling, &b.NodeCount, &b.MinNodeCount, &b.MaxNodeCount); err != nil {
+			return nil, errors.Wrap(err, "failed to read configuration node pool backup")
+		}
+		return b, nil
+	}
+	parts := strings.Split(value, "_")
+	if len(parts) < 6 {
+		return nil, errors.Errorf("invalid backup label value '%s'", value)
+	}
+	var err error
+	if b.Version, err = strconv.Atoi(parts[0][1:]); err != nil {
+		return nil, errors.Errorf("invalid backup label value '%s'", value)
+	}
+	if b.Version > BACKUP_VERSION {
+		return nil, errors.Errorf("unsupported node group backup version %d", b.Version)
+	}
+	if _, err = fmt.Sscanf(strings.Join(parts[1:5], "_"), backup_FORMAT, &b.Autoscaling, &b.NodeCount, &b.MinNodeCount, &b.MaxNodeCount); err != nil {
+		return nil, errors.Wrapf(err, "invalid backup label value '%s'", value)
+	}
+	unix, err := strconv.ParseInt(parts[5], 36, 64)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to read configuration node pool backup")
+		return nil, errors.Errorf("invalid backup label value '%s'", value)
 	}
-	return &NodeGroup{
-		Name:         name,
-		NodeCount:    count,
-		MinNodeCount: min,
-		MaxNodeCount: max,
-		Autoscaling:  autoscaling,
-	}, nil
+	b.Time = time.Unix(unix, 0).UTC()
+	for _, part := range parts[6:] {
+		i := strings.LastIndex(part, "-")
+		count, err := strconv.ParseInt(part[i+1:], 10, 32)
+		if i < 1 || err != nil {
+			return nil, errors.Errorf("invalid backup label value '%s'", value)
+		}
+		if b.Zones == nil {
+			b.Zones = map[string]int32{}
+		}
+		b.Zones[part[:i]] = int32(count)
+	}
+	return b, nil
 }
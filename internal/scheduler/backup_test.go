@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestBackup(t *testing.T) {
+	now := time.Date(2020, 4, 15, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		ng        NodeGroup
+		wantZones map[string]int32
+	}{
+		{
+			name: "fixed size",
+			ng:   NodeGroup{Name: "default", NodeCount: 3},
+		},
+		{
+			name: "autoscaling",
+			ng:   NodeGroup{Name: "workers", NodeCount: 3, MinNodeCount: 1, MaxNodeCount: 5, Autoscaling: true},
+		},
+		{
+			name: "regional with long name",
+			ng: NodeGroup{
+				Name:         "very-long-node-pool-name-for-batch-processing-jobs",
+				NodeCount:    200,
+				MinNodeCount: 100,
+				MaxNodeCount: 1000,
+				Autoscaling:  true,
+				Zones:        map[string]int32{"europe-west1-b": 200, "europe-west1-c": 150, "europe-west1-d": 120, "europe-west1-e": 100},
+			},
+			wantZones: map[string]int32{"b": 200, "c": 150, "d": 120, "e": 100},
+		},
+	}
+	labelValue := regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := BackupLabel(NewBackup(tt.ng, now))
+			if err != nil {
+				t.Fatalf("BackupLabel() error = %v", err)
+			}
+			if !labelValue.MatchString(value) {
+				t.Errorf("BackupLabel() value %q is not label safe", value)
+			}
+			b, err := ParseBackupLabels(tt.ng.Name, map[string]string{GetBackupLabel(tt.ng.Name): value})
+			if err != nil {
+				t.Fatalf("ParseBackupLabels() error = %v", err)
+			}
+			if b.Version != BACKUP_VERSION || !b.Time.Equal(now) {
+				t.Errorf("ParseBackupLabels() version = %d, time = %v", b.Version, b.Time)
+			}
+			want := tt.ng
+			want.Zones = tt.wantZones
+			if got := b.NodeGroup(tt.ng.Name); !reflect.DeepEqual(*got, want) {
+				t.Errorf("NodeGroup() = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestLabelStore(t *testing.T) {
+	now := time.Date(2020, 4, 15, 22, 0, 0, 0, time.UTC)
+	zones := map[string]int32{"europe-west1-b": 2, "europe-west1-c": 1}
+	cluster := Cluster{
+		Name:     "dev",
+		Location: "europe-west1",
+		Labels:   map[string]string{},
+		Nodes: []NodeGroup{{
+			Name:           "workers",
+			NodeCount:      2,
+			Zones:          zones,
+			InstanceGroups: map[string]string{"europe-west1-b": "ig-b", "europe-west1-c": "ig-c"},
+		}},
+	}
+	labels, err := LabelStore{}.Labels(NewClusterBackup(cluster, now))
+	if err != nil {
+		t.Fatalf("Labels() error = %v", err)
+	}
+	if len(labels) != 1 {
+		t.Errorf("Labels() = %v, want single label", labels)
+	}
+	for k, v := range labels {
+		cluster.Labels[k] = v
+	}
+	backup, err := LoadBackup(context.Background(), LabelStore{}, cluster, "")
+	if err != nil {
+		t.Fatalf("LoadBackup() error = %v", err)
+	}
+	if got := backup.NodeGroups["workers"].Zones; !reflect.DeepEqual(got, zones) {
+		t.Errorf("LoadBackup() zones = %v, want %v", got, zones)
+	}
+}
+
+func TestParseBackupLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    *NodeGroup
+		wantErr bool
+	}{
+		{
+			name:   "legacy format",
+			labels: map[string]string{"cs-pool-size": "true_3_1_5"},
+			want:   &NodeGroup{Name: "pool", NodeCount: 3, MinNodeCount: 1, MaxNodeCount: 5, Autoscaling: true},
+		},
+		{
+			name:   "legacy format without autoscaling",
+			labels: map[string]string{"cs-pool-size": "false_2_0_0"},
+			want:   &NodeGroup{Name: "pool", NodeCount: 2},
+		},
+		{
+			name:    "missing backup",
+			labels:  map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:   "zones",
+			labels: map[string]string{"cs-pool-size": "v2_false_2_0_0_q8h6dc_b-2_c-1"},
+			want:   &NodeGroup{Name: "pool", NodeCount: 2, Zones: map[string]int32{"b": 2, "c": 1}},
+		},
+		{
+			name:    "invalid backup",
+			labels:  map[string]string{"cs-pool-size": "v2_true_3_1"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid zone",
+			labels:  map[string]string{"cs-pool-size": "v2_false_2_0_0_q8h6dc_b2"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported version",
+			labels:  map[string]string{"cs-pool-size": "v3_false_2_0_0_q8h6dc"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ParseBackupLabels("pool", tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBackupLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := b.NodeGroup("pool"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NodeGroup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package scheduler
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	date_FORMAT     = "2006-01-02"
+	ics_DATE_FORMAT = "20060102"
+	// iCalendar event category marking inclusion (keep up) dates
+	ics_INCLUDE_CATEGORY = "include"
+)
+
+// DateRange is an inclusive range of calendar days
+type DateRange struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// contains reports whether calendar day of t (in t location) is inside the range
+func (r DateRange) contains(t time.Time) bool {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return !day.Before(r.From) && !day.After(r.To)
+}
+
+// Calendar overrides cluster schedule on specific dates:
+// cluster is up on Include dates and down on Exclude dates (holidays); Include wins
+type Calendar struct {
+	Name    string
+	Include []DateRange
+	Exclude []DateRange
+}
+
+// Calendars are loaded calendars by name
+type Calendars map[string]*Calendar
+
+// Override returns desired cluster status for calendar day of t, or empty string if there is no override
+func (c *Calendar) Override(t time.Time) string {
+	for _, r := range c.Include {
+		if r.contains(t) {
+			return STATUS_UP
+		}
+	}
+	for _, r := range c.Exclude {
+		if r.contains(t) {
+			return STATUS_DOWN
+		}
+	}
+	return ""
+}
+
+// LoadCalendars loads calendars from YAML (.yaml, .yml) and iCalendar (.ics) files in directory;
+// calendar name is the file name without extension
+func LoadCalendars(dir string) (Calendars, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read calendars directory")
+	}
+	result := Calendars{}
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || ext != ".yaml" && ext != ".yml" && ext != ".ics" {
+			continue
+		}
+		cal, err := LoadCalendar(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		result[cal.Name] = cal
+	}
+	return result, nil
+}
+
+// LoadCalendar loads calendar from YAML or iCalendar file
+func LoadCalendar(path string) (*Calendar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open calendar")
+	}
+	defer f.Close()
+	ext := filepath.Ext(path)
+	var cal *Calendar
+	if ext == ".ics" {
+		cal, err = ParseICS(f)
+	} else {
+		cal, err = ParseCalendarYAML(f)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse calendar '%s'", path)
+	}
+	cal.Name = strings.TrimSuffix(filepath.Base(path), ext)
+	return cal, nil
+}
+
+type yamlDateRange struct {
+	Name string `yaml:"name"`
+	Date string `yaml:"date"`
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// ParseCalendarYAML parses calendar in YAML format:
+//
+//	exclude:
+//	  - name: Christmas
+//	    date: 2020-12-25
+//	include:
+//	  - name: release week
+//	    from: 2020-06-01
+//	    to: 2020-06-07
+func ParseCalendarYAML(r io.Reader) (*Calendar, error) {
+	var doc struct {
+		Include []yamlDateRange `yaml:"include"`
+		Exclude []yamlDateRange `yaml:"exclude"`
+	}
+	if err := yaml.NewDecoder(r).Decode(&doc); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "failed to decode YAML")
+	}
+	cal := &Calendar{}
+	for _, list := range []struct {
+		src []yamlDateRange
+		dst *[]DateRange
+	}{{doc.Include, &cal.Include}, {doc.Exclude, &cal.Exclude}} {
+		for _, y := range list.src {
+			from, to := y.From, y.To
+			if y.Date != "" {
+				from, to = y.Date, y.Date
+			}
+			r, err := parseDateRange(y.Name, from, to, date_FORMAT)
+			if err != nil {
+				return nil, err
+			}
+			*list.dst = append(*list.dst, *r)
+		}
+	}
+	return cal, nil
+}
+
+func parseDateRange(name, from, to, layout string) (*DateRange, error) {
+	f, err := time.Parse(layout, from)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid date '%s'", from)
+	}
+	t, err := time.Parse(layout, to)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid date '%s'", to)
+	}
+	if t.Before(f) {
+		return nil, errors.Errorf("'to' date %s is before 'from' date %s", to, from)
+	}
+	return &DateRange{Name: name, From: f, To: t}, nil
+}
+
+// ParseICS parses iCalendar all-day events: events with 'include' category are inclusions,
+// all other events are exclusions; recurring events (RRULE) are not expanded
+func ParseICS(r io.Reader) (*Calendar, error) {
+	// unfold content lines
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read iCalendar")
+	}
+	cal := &Calendar{}
+	var event map[string]string
+	for _, line := range lines {
+		switch line {
+		case "BEGIN:VEVENT":
+			event = map[string]string{}
+			continue
+		case "END:VEVENT":
+			if event == nil {
+				return nil, errors.New("unexpected END:VEVENT")
+			}
+			r, include, err := icsDateRange(event)
+			if err != nil {
+				return nil, err
+			}
+			if include {
+				cal.Include = append(cal.Include, *r)
+			} else {
+				cal.Exclude = append(cal.Exclude, *r)
+			}
+			event = nil
+			continue
+		}
+		if event == nil {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		// drop property parameters, like DTSTART;VALUE=DATE
+		name := strings.SplitN(line[:i], ";", 2)[0]
+		event[strings.ToUpper(name)] = line[i+1:]
+	}
+	return cal, nil
+}
+
+func icsDateRange(event map[string]string) (*DateRange, bool, error) {
+	start := event["DTSTART"]
+	if len(start) < len(ics_DATE_FORMAT) {
+		return nil, false, errors.Errorf("invalid event DTSTART '%s'", start)
+	}
+	start = start[:len(ics_DATE_FORMAT)]
+	end := start
+	if dtend := event["DTEND"]; len(dtend) >= len(ics_DATE_FORMAT) {
+		end = dtend[:len(ics_DATE_FORMAT)]
+		// DTEND is exclusive for all-day events
+		if len(dtend) == len(ics_DATE_FORMAT) && end != start {
+			t, err := time.Parse(ics_DATE_FORMAT, end)
+			if err != nil {
+				return nil, false, errors.Wrapf(err, "invalid event DTEND '%s'", dtend)
+			}
+			end = t.AddDate(0, 0, -1).Format(ics_DATE_FORMAT)
+		}
+	}
+	r, err := parseDateRange(event["SUMMARY"], start, end, ics_DATE_FORMAT)
+	if err != nil {
+		return nil, false, err
+	}
+	include := false
+	for _, c := range strings.Split(event["CATEGORIES"], ",") {
+		if strings.EqualFold(strings.TrimSpace(c), ics_INCLUDE_CATEGORY) {
+			include = true
+		}
+	}
+	return r, include, nil
+}
@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCalendarYAML = `
+exclude:
+  - name: Christmas
+    date: 2020-12-25
+  - name: New Year
+    from: 2020-12-31
+    to: 2021-01-01
+include:
+  - name: release week
+    from: 2020-12-28
+    to: 2021-01-03
+`
+
+const testCalendarICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20201225\r\n" +
+	"DTEND;VALUE=DATE:20201227\r\n" +
+	"SUMMARY:Christmas \r\n" +
+	" Holidays\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20201228T090000Z\r\n" +
+	"SUMMARY:Release\r\n" +
+	"CATEGORIES:RELEASE,INCLUDE\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseCalendarYAML(t *testing.T) {
+	cal, err := ParseCalendarYAML(strings.NewReader(testCalendarYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.Exclude) != 2 || len(cal.Include) != 1 {
+		t.Fatalf("ParseCalendarYAML() = %d exclude, %d include dates, want 2, 1", len(cal.Exclude), len(cal.Include))
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want string
+	}{
+		{name: "excluded", t: time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC), want: STATUS_DOWN},
+		{name: "included wins", t: time.Date(2020, 12, 31, 10, 0, 0, 0, time.UTC), want: STATUS_UP},
+		{name: "no override", t: time.Date(2020, 12, 24, 10, 0, 0, 0, time.UTC), want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cal.Override(tt.t); got != tt.want {
+				t.Errorf("Override() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseICS(t *testing.T) {
+	cal, err := ParseICS(strings.NewReader(testCalendarICS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.Exclude) != 1 || len(cal.Include) != 1 {
+		t.Fatalf("ParseICS() = %d exclude, %d include dates, want 1, 1", len(cal.Exclude), len(cal.Include))
+	}
+	christmas := cal.Exclude[0]
+	if christmas.Name != "Christmas Holidays" || christmas.To.Format(date_FORMAT) != "2020-12-26" {
+		t.Errorf("ParseICS() exclude = %+v, want 'Christmas Holidays' till 2020-12-26", christmas)
+	}
+	if got := cal.Override(time.Date(2020, 12, 28, 20, 0, 0, 0, time.UTC)); got != STATUS_UP {
+		t.Errorf("Override() = %q, want %q", got, STATUS_UP)
+	}
+}
+
+func TestSchedule_IsInRangeCalendar(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "holidays.yaml"), []byte(testCalendarYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cals, err := LoadCalendars(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedule, err := ParseSchedule(map[string]string{
+		UPTIME_LABEL:   "8-19_1-6_x_x",
+		CALENDAR_LABEL: "holidays",
+		TIMEZONE_LABEL: "america--new_york",
+	}, cals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		// Friday, Christmas
+		{name: "holiday", t: time.Date(2020, 12, 25, 15, 0, 0, 0, time.UTC), want: false},
+		// Saturday, release week
+		{name: "release week", t: time.Date(2021, 1, 2, 15, 0, 0, 0, time.UTC), want: true},
+		// Sunday 02:00 UTC is Saturday in New York, release week
+		{name: "release week in time zone", t: time.Date(2021, 1, 4, 2, 0, 0, 0, time.UTC), want: true},
+		// Thursday, regular working day
+		{name: "working day", t: time.Date(2020, 11, 19, 15, 0, 0, 0, time.UTC), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, got := schedule.IsInRange(tt.t); got != tt.want {
+				t.Errorf("IsInRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err = ParseSchedule(map[string]string{UPTIME_LABEL: "8-19_1-6_x_x", CALENDAR_LABEL: "unknown"}, cals); err == nil {
+		t.Error("ParseSchedule() with unknown calendar, want error")
+	}
+}
+
+func TestSchedule_NextTransitionCalendar(t *testing.T) {
+	cal, err := ParseCalendarYAML(strings.NewReader(testCalendarYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uptime, err := ParseUptime("8-19_1-6_x_x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := Schedule{Windows: []Window{uptime}, Calendar: cal, Location: time.UTC}
+	// Thursday before Christmas: down in the evening, stays down on Christmas, up after weekend (release week)
+	got, status := schedule.NextTransition(time.Date(2020, 12, 24, 12, 0, 0, 0, time.UTC))
+	want := time.Date(2020, 12, 24, 19, 0, 0, 0, time.UTC)
+	if !got.Equal(want) || status != STATUS_DOWN {
+		t.Errorf("NextTransition() = %v, %q, want %v, %q", got, status, want, STATUS_DOWN)
+	}
+	got, status = schedule.NextTransition(want)
+	want = time.Date(2020, 12, 28, 0, 0, 0, 0, time.UTC)
+	if !got.Equal(want) || status != STATUS_UP {
+		t.Errorf("NextTransition() = %v, %q, want %v, %q", got, status, want, STATUS_UP)
+	}
+}
@@ -0,0 +1,263 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// how far to look for cron event
+	cron_SEARCH_YEARS = 5
+	// max number of cron events to check for cron range transition
+	cron_SEARCH_EVENTS = 1000
+)
+
+// label-safe cron expression encoding: GKE label values can contain only lowercase letters,
+// digits, '_' and '-', so fields are separated by '_', '*' is written as 'x',
+// '/' as 's' and ',' as 'c'; for example '0_8_x_x_1-5' is '0 8 * * 1-5' and 'xs15_x_x_x_x' is '*/15 * * * *'
+var cronDecoder = strings.NewReplacer("_", " ", "x", "*", "s", "/", "c", ",")
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 7},  // day of week (0 or 7 is Sunday)
+}
+
+// CronExpr is a parsed standard 5-field cron expression (numeric values only)
+type CronExpr struct {
+	// plain cron expression
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	// day of month or day of week is '*'
+	domStar, dowStar bool
+}
+
+// ParseCron parses 5-field cron expression, either plain or label-safe encoded
+func ParseCron(spec string) (*CronExpr, error) {
+	if !strings.Contains(spec, " ") {
+		spec = cronDecoder.Replace(spec)
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, errors.New("cron expression should contain 5 fields: minute hour day-of-month month day-of-week")
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseCronField(f, cronFields[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cron field '%s'", f)
+		}
+		bits[i] = b
+	}
+	// Sunday is either 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &CronExpr{
+		spec:    strings.Join(fields, " "),
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(spec string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(spec, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step < 1 {
+				return 0, errors.New("invalid step")
+			}
+			item = item[:i]
+		}
+		from, to := f.min, f.max
+		if item != "*" {
+			r := strings.Split(item, "-")
+			if len(r) > 2 {
+				return 0, errors.New("invalid range, must be of form 'from-to'")
+			}
+			var err error
+			if from, err = strconv.Atoi(r[0]); err != nil {
+				return 0, errors.Wrap(err, "invalid value")
+			}
+			to = from
+			if len(r) == 2 {
+				if to, err = strconv.Atoi(r[1]); err != nil {
+					return 0, errors.Wrap(err, "invalid value")
+				}
+			} else if step > 1 {
+				// 'n/step' means from n to max
+				to = f.max
+			}
+			if from < f.min || to > f.max || from > to {
+				return 0, errors.Errorf("out of allowed range: %d-%d", f.min, f.max)
+			}
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *CronExpr) String() string {
+	return c.spec
+}
+
+func (c *CronExpr) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	// standard cron: if both day of month and day of week are restricted, either can match
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Prev returns the latest cron event at or before t
+func (c *CronExpr) Prev(t time.Time) (time.Time, bool) {
+	loc := t.Location()
+	limit := t.Year() - cron_SEARCH_YEARS
+	t = t.Truncate(time.Minute)
+	for t.Year() > limit {
+		y, m, d := t.Date()
+		var prev time.Time
+		switch {
+		case c.month&(1<<uint(m)) == 0:
+			// jump to the last minute of the previous month
+			prev = time.Date(y, m, 1, 0, 0, 0, 0, loc).Add(-time.Minute)
+		case !c.matchDay(t):
+			// jump to the last minute of the previous day
+			prev = time.Date(y, m, d, 0, 0, 0, 0, loc).Add(-time.Minute)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			// jump to the last minute of the previous hour
+			prev = time.Date(y, m, d, t.Hour(), 0, 0, 0, loc).Add(-time.Minute)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			prev = t.Add(-time.Minute)
+		default:
+			return t, true
+		}
+		// ambiguous wall clock time on DST change can resolve to a later instant
+		if !prev.Before(t) {
+			prev = t.Add(-time.Minute)
+		}
+		t = prev
+	}
+	return time.Time{}, false
+}
+
+// Next returns the earliest cron event after t
+func (c *CronExpr) Next(t time.Time) (time.Time, bool) {
+	loc := t.Location()
+	limit := t.Year() + cron_SEARCH_YEARS
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for t.Year() < limit {
+		y, m, d := t.Date()
+		var next time.Time
+		switch {
+		case c.month&(1<<uint(m)) == 0:
+			// jump to the first minute of the next month
+			next = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchDay(t):
+			// jump to the first minute of the next day
+			next = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			// jump to the first minute of the next hour
+			next = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+		// ambiguous wall clock time on DST change can resolve to an earlier instant
+		if !next.After(t) {
+			next = t.Add(time.Minute)
+		}
+		t = next
+	}
+	return time.Time{}, false
+}
+
+// CronRange is an uptime window between 'start' and 'stop' cron events
+type CronRange struct {
+	Start CronExpr
+	Stop  CronExpr
+	// time zone to evaluate cron expressions in; time location is used when nil
+	Location *time.Location
+}
+
+// ParseCronRange parses 'start' and 'stop' cron expressions
+func ParseCronRange(start, stop string) (*CronRange, error) {
+	startExpr, err := ParseCron(start)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid start cron expression")
+	}
+	stopExpr, err := ParseCron(stop)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid stop cron expression")
+	}
+	return &CronRange{Start: *startExpr, Stop: *stopExpr}, nil
+}
+
+// IsInRange reports whether the last 'start' event before t is later than the last 'stop' event
+func (c *CronRange) IsInRange(t time.Time) bool {
+	if c.Location != nil {
+		t = t.In(c.Location)
+	}
+	start, ok := c.Start.Prev(t)
+	if !ok {
+		return false
+	}
+	stop, ok := c.Stop.Prev(t)
+	if !ok {
+		return true
+	}
+	return start.After(stop)
+}
+
+func (c *CronRange) String() string {
+	return fmt.Sprintf("start(%s) stop(%s)", c.Start.String(), c.Stop.String())
+}
+
+// NextTransition returns the first 'start' or 'stop' event after t that changes IsInRange result,
+// and cluster status after it; empty status means no transition is found
+func (c *CronRange) NextTransition(from time.Time) (time.Time, string) {
+	t := from
+	if c.Location != nil {
+		t = t.In(c.Location)
+	}
+	current := c.IsInRange(t)
+	for i := 0; i < cron_SEARCH_EVENTS; i++ {
+		start, okStart := c.Start.Next(t)
+		stop, okStop := c.Stop.Next(t)
+		switch {
+		case okStart && (!okStop || start.Before(stop)):
+			t = start
+		case okStop:
+			t = stop
+		default:
+			return time.Time{}, ""
+		}
+		if in := c.IsInRange(t); in != current {
+			return t, statusOf(in)
+		}
+	}
+	return time.Time{}, ""
+}
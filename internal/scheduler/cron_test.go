@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "plain", spec: "0 8 * * 1-5"},
+		{name: "label-safe", spec: "0_8_x_x_1-5"},
+		{name: "label-safe step and list", spec: "xs15_8c12_x_x_0-6"},
+		{name: "sunday as 7", spec: "0 8 * * 7"},
+		{name: "too few fields", spec: "0 8 * *", wantErr: true},
+		{name: "minute out of range", spec: "60 8 * * *", wantErr: true},
+		{name: "inverted range", spec: "0 8 * * 5-1", wantErr: true},
+		{name: "invalid step", spec: "*/0 8 * * *", wantErr: true},
+		{name: "names", spec: "0 8 * * mon-fri", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCron(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCron() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCronExpr_Prev(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		t    time.Time
+		want time.Time
+	}{
+		{
+			name: "same day",
+			spec: "30 8 * * 1-5",
+			t:    time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC),
+			want: time.Date(2020, 4, 15, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "exact minute",
+			spec: "30 8 * * 1-5",
+			t:    time.Date(2020, 4, 15, 8, 30, 45, 0, time.UTC),
+			want: time.Date(2020, 4, 15, 8, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "over weekend",
+			spec: "0 19 * * 1-5",
+			t:    time.Date(2020, 4, 20, 7, 0, 0, 0, time.UTC),
+			want: time.Date(2020, 4, 17, 19, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "step",
+			spec: "*/15 * * * *",
+			t:    time.Date(2020, 4, 15, 10, 44, 0, 0, time.UTC),
+			want: time.Date(2020, 4, 15, 10, 30, 0, 0, time.UTC),
+		},
+		{
+			name: "day of month or day of week",
+			spec: "0 0 1 * 0",
+			t:    time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC),
+			want: time.Date(2020, 4, 12, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "previous year",
+			spec: "0 9 1 1 *",
+			t:    time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC),
+			want: time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCron(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := c.Prev(tt.t)
+			if !ok || !got.Equal(tt.want) {
+				t.Errorf("Prev() = %v, %v, want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronRange_IsInRange(t *testing.T) {
+	// 08:30-19:00 Monday to Friday
+	cron, err := ParseCronRange("30_8_x_x_1-5", "0_19_x_x_1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{name: "before start", t: time.Date(2020, 4, 15, 8, 29, 0, 0, time.UTC), want: false},
+		{name: "at start", t: time.Date(2020, 4, 15, 8, 30, 0, 0, time.UTC), want: true},
+		{name: "working hours", t: time.Date(2020, 4, 15, 12, 0, 0, 0, time.UTC), want: true},
+		{name: "at stop", t: time.Date(2020, 4, 15, 19, 0, 0, 0, time.UTC), want: false},
+		{name: "weekend", t: time.Date(2020, 4, 18, 12, 0, 0, 0, time.UTC), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cron.IsInRange(tt.t); got != tt.want {
+				t.Errorf("IsInRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronRange_NextTransition(t *testing.T) {
+	cron, err := ParseCronRange("30_8_x_x_1-5", "0_19_x_x_1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, status := cron.NextTransition(time.Date(2020, 4, 17, 20, 0, 0, 0, time.UTC))
+	want := time.Date(2020, 4, 20, 8, 30, 0, 0, time.UTC)
+	if !got.Equal(want) || status != STATUS_UP {
+		t.Errorf("NextTransition() = %v, %q, want %v, %q", got, status, want, STATUS_UP)
+	}
+	got, status = cron.NextTransition(want)
+	want = time.Date(2020, 4, 20, 19, 0, 0, 0, time.UTC)
+	if !got.Equal(want) || status != STATUS_DOWN {
+		t.Errorf("NextTransition() = %v, %q, want %v, %q", got, status, want, STATUS_DOWN)
+	}
+}
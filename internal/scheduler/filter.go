@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Filter selects clusters by name, location, project and labels; empty filter matches all clusters
+type Filter struct {
+	// cluster name patterns (shell file name patterns, e.g. 'sandbox-*')
+	Names     []string
+	Locations []string
+	Projects  []string
+	// required cluster labels
+	Selector map[string]string
+}
+
+// ParseSelector parses 'key=value' label selectors
+func ParseSelector(specs []string) (map[string]string, error) {
+	selector := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		kv := strings.SplitN(spec, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Errorf("invalid selector '%s', must be of form 'key=value'", spec)
+		}
+		selector[kv[0]] = kv[1]
+	}
+	return selector, nil
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether cluster matches all filter conditions
+func (f *Filter) Match(c Cluster) bool {
+	if f == nil {
+		return true
+	}
+	if !matchAny(f.Names, c.Name) || !matchAny(f.Locations, c.Location) || !matchAny(f.Projects, c.Project) {
+		return false
+	}
+	for k, v := range f.Selector {
+		if value, ok := c.Labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns clusters matching filter
+func (f *Filter) Apply(clusters []Cluster) []Cluster {
+	var result []Cluster
+	for _, c := range clusters {
+		if f.Match(c) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// ProjectLister is implemented by runners listing clusters of other projects than the default one (GKE)
+type ProjectLister interface {
+	// ListProjects lists clusters of projects
+	ListProjects(ctx context.Context, projects []string) ([]Cluster, error)
+}
+
+// ListClusters lists clusters matching filter. Runner implementing ProjectLister lists clusters of filter
+// projects, which must be project IDs then, instead of clusters of its default project.
+func ListClusters(ctx context.Context, r Runner, f *Filter) ([]Cluster, error) {
+	var (
+		clusters []Cluster
+		err      error
+	)
+	if lister, ok := r.(ProjectLister); ok && f != nil && len(f.Projects) > 0 {
+		for _, project := range f.Projects {
+			if strings.ContainsAny(project, `*?[\`) {
+				return nil, errors.Errorf("project pattern '%s' is not supported: clusters are listed by project ID", project)
+			}
+		}
+		clusters, err = lister.ListProjects(ctx, f.Projects)
+	} else {
+		clusters, err = r.List(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f.Apply(clusters), nil
+}
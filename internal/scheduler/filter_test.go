@@ -0,0 +1,53 @@
+package scheduler
+
+import "testing"
+
+func TestFilter_Apply(t *testing.T) {
+	clusters := []Cluster{
+		{Name: "sandbox-1", Location: "us-central1", Project: "dev", Labels: map[string]string{"team": "a"}},
+		{Name: "sandbox-2", Location: "europe-west1", Project: "dev", Labels: map[string]string{"team": "b"}},
+		{Name: "staging", Location: "us-central1", Project: "stage", Labels: map[string]string{"team": "a"}},
+	}
+	tests := []struct {
+		name   string
+		filter *Filter
+		want   []string
+	}{
+		{name: "no filter", filter: nil, want: []string{"sandbox-1", "sandbox-2", "staging"}},
+		{name: "empty filter", filter: &Filter{}, want: []string{"sandbox-1", "sandbox-2", "staging"}},
+		{name: "name", filter: &Filter{Names: []string{"sandbox-2"}}, want: []string{"sandbox-2"}},
+		{name: "name pattern", filter: &Filter{Names: []string{"sandbox-*"}}, want: []string{"sandbox-1", "sandbox-2"}},
+		{name: "location", filter: &Filter{Locations: []string{"us-central1"}}, want: []string{"sandbox-1", "staging"}},
+		{name: "project", filter: &Filter{Projects: []string{"stage"}}, want: []string{"staging"}},
+		{
+			name:   "selector and name",
+			filter: &Filter{Names: []string{"sandbox-*"}, Selector: map[string]string{"team": "a"}},
+			want:   []string{"sandbox-1"},
+		},
+		{name: "missing label", filter: &Filter{Selector: map[string]string{"owner": ""}}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range tt.filter.Apply(clusters) {
+				got = append(got, c.Name)
+			}
+			if !equal(got, tt.want) {
+				t.Errorf("Apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	got, err := ParseSelector([]string{"team=a", "env=dev=1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["team"] != "a" || got["env"] != "dev=1" {
+		t.Errorf("ParseSelector() = %v", got)
+	}
+	if _, err = ParseSelector([]string{"team"}); err == nil {
+		t.Error("ParseSelector() without value, want error")
+	}
+}
@@ -0,0 +1,106 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+// instanceGroups is a subset of Compute Engine API used to read and resize node pool managed instance groups
+type instanceGroups interface {
+	// Size returns target size of managed instance group
+	Size(ctx context.Context, url string) (int32, error)
+	// Resize sets target size of managed instance group and waits for resize operation to complete
+	Resize(ctx context.Context, url string, size int32) error
+}
+
+// ComputeOperationError is returned when Compute Engine zone operation (e.g. instance group resize) is completed with error
+type ComputeOperationError struct {
+	Operation string
+	Type      string
+	Zone      string
+	Message   string
+}
+
+func (e *ComputeOperationError) Error() string {
+	return fmt.Sprintf("compute operation %s (%s) in zone %s failed: %s", e.Operation, e.Type, e.Zone, e.Message)
+}
+
+// computeInstanceGroups reads and resizes managed instance groups through Compute Engine API
+type computeInstanceGroups struct {
+	managers   *compute.InstanceGroupManagersService
+	operations *compute.ZoneOperationsService
+}
+
+func newComputeInstanceGroups(ctx context.Context, opts ...option.ClientOption) (*computeInstanceGroups, error) {
+	opts = append([]option.ClientOption{option.WithScopes(compute.ComputeScope)}, opts...)
+	svc, err := compute.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create compute client")
+	}
+	return &computeInstanceGroups{
+		managers:   compute.NewInstanceGroupManagersService(svc),
+		operations: compute.NewZoneOperationsService(svc),
+	}, nil
+}
+
+func (c *computeInstanceGroups) Size(ctx context.Context, url string) (int32, error) {
+	project, zone, name, err := parseInstanceGroupURL(url)
+	if err != nil {
+		return 0, err
+	}
+	igm, err := c.managers.Get(project, zone, name).Context(ctx).Do()
+	if err != nil {
+		return 0, err
+	}
+	return int32(igm.TargetSize), nil
+}
+
+func (c *computeInstanceGroups) Resize(ctx context.Context, url string, size int32) error {
+	project, zone, name, err := parseInstanceGroupURL(url)
+	if err != nil {
+		return err
+	}
+	op, err := c.managers.Resize(project, zone, name, int64(size)).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	for op.Status != "DONE" {
+		// Wait returns when operation is done or after ~2 minutes
+		if op, err = c.operations.Wait(project, zone, op.Name).Context(ctx).Do(); err != nil {
+			return errors.Wrap(err, "failed to wait for resize operation")
+		}
+	}
+	if op.Error != nil && len(op.Error.Errors) > 0 {
+		var msgs []string
+		for _, e := range op.Error.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return &ComputeOperationError{Operation: op.Name, Type: op.OperationType, Zone: zone, Message: strings.Join(msgs, "; ")}
+	}
+	return nil
+}
+
+// parseInstanceGroupURL returns project, zone and name of managed instance group
+// from URL: https://www.googleapis.com/compute/v1/projects/*/zones/*/instanceGroupManagers/*
+func parseInstanceGroupURL(url string) (project, zone, name string, err error) {
+	parts := strings.Split(url, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		switch parts[i] {
+		case "projects":
+			project = parts[i+1]
+		case "zones":
+			zone = parts[i+1]
+		case "instanceGroupManagers", "instanceGroups":
+			name = parts[i+1]
+		}
+	}
+	if project == "" || zone == "" || name == "" {
+		return "", "", "", errors.Errorf("invalid instance group URL '%s'", url)
+	}
+	return project, zone, name, nil
+}
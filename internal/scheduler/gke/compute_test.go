@@ -0,0 +1,108 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/option"
+)
+
+func Test_parseInstanceGroupURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		zone    string
+		group   string
+		wantErr bool
+	}{
+		{
+			name:  "instance group manager",
+			url:   "https://www.googleapis.com/compute/v1/projects/demo/zones/us-central1-a/instanceGroupManagers/gke-dev-pool-grp",
+			zone:  "us-central1-a",
+			group: "gke-dev-pool-grp",
+		},
+		{
+			name:  "instance group",
+			url:   "https://www.googleapis.com/compute/v1/projects/demo/zones/europe-west1-b/instanceGroups/gke-dev-pool-grp",
+			zone:  "europe-west1-b",
+			group: "gke-dev-pool-grp",
+		},
+		{
+			name:    "regional",
+			url:     "https://www.googleapis.com/compute/v1/projects/demo/regions/us-central1/instanceGroupManagers/grp",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, zone, group, err := parseInstanceGroupURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseInstanceGroupURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (project != "demo" || zone != tt.zone || group != tt.group) {
+				t.Errorf("parseInstanceGroupURL() = %s, %s, %s, want demo, %s, %s", project, zone, group, tt.zone, tt.group)
+			}
+		})
+	}
+}
+
+func TestComputeInstanceGroups_Resize(t *testing.T) {
+	const url = "https://www.googleapis.com/compute/v1/projects/demo/zones/us-central1-a/instanceGroupManagers/gke-dev-pool-grp"
+	tests := []struct {
+		name    string
+		op      string
+		wantErr bool
+	}{
+		{
+			name: "done",
+			op:   `{"name": "op-1", "operationType": "compute.instanceGroupManagers.resize", "status": "DONE"}`,
+		},
+		{
+			name:    "failed",
+			op:      `{"name": "op-1", "operationType": "compute.instanceGroupManagers.resize", "status": "DONE", "error": {"errors": [{"message": "quota exceeded"}]}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var polls int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch {
+				case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/instanceGroupManagers/gke-dev-pool-grp/resize"):
+					// resize operation is running
+					fmt.Fprint(w, `{"name": "op-1", "operationType": "compute.instanceGroupManagers.resize", "status": "RUNNING"}`)
+				case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/zones/us-central1-a/operations/op-1/wait"):
+					polls++
+					fmt.Fprint(w, tt.op)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer srv.Close()
+			ig, err := newComputeInstanceGroups(context.Background(), option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ig.Resize(context.Background(), url, 3)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if polls != 1 {
+				t.Errorf("Resize() waited for operation %d times, want 1", polls)
+			}
+			if !tt.wantErr {
+				return
+			}
+			// Compute Engine operation error, not GKE one
+			opErr, ok := err.(*ComputeOperationError)
+			if !ok || opErr.Zone != "us-central1-a" || opErr.Type != "compute.instanceGroupManagers.resize" || opErr.Message != "quota exceeded" {
+				t.Errorf("Resize() error = %#v, want ComputeOperationError", err)
+			}
+		})
+	}
+}
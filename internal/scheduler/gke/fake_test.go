@@ -0,0 +1,278 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	containerpb "google.golang.org/genproto/googleapis/container/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeGke is an in-process fake of GKE ClusterManager gRPC service
+type fakeGke struct {
+	containerpb.UnimplementedClusterManagerServer
+	mu       sync.Mutex
+	project  string
+	clusters []*containerpb.Cluster
+	// clusters of other projects, listed only
+	others map[string][]*containerpb.Cluster
+	// operations are completed after number of GetOperation polls
+	polls      int
+	operations map[string]*fakeOperation
+	// number of mutating calls to reject with concurrent operation error
+	busy int
+	// mutating calls counter
+	calls int
+	// managed instance group sizes by URL
+	groups map[string]int32
+	// error of instance group calls (e.g. missing Compute Engine permission)
+	groupErr error
+	// instance group resize calls counter
+	resizes int
+}
+
+type fakeOperation struct {
+	op      *containerpb.Operation
+	cluster string
+	polls   int
+}
+
+func newFakeGke(project string, clusters ...*containerpb.Cluster) *fakeGke {
+	groups := map[string]int32{}
+	for _, c := range clusters {
+		if c.LabelFingerprint == "" {
+			c.LabelFingerprint = "fp-0"
+		}
+		for _, np := range c.NodePools {
+			for _, url := range np.InstanceGroupUrls {
+				groups[url] = np.InitialNodeCount
+			}
+		}
+	}
+	return &fakeGke{project: project, clusters: clusters, polls: 2, operations: map[string]*fakeOperation{}, groups: groups}
+}
+
+// start serves fake over in-memory connection and returns GkeScheduler using it
+func (f *fakeGke) start(t *testing.T) *GkeScheduler {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	containerpb.RegisterClusterManagerServer(srv, f)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	r, err := NewGkeScheduler(context.Background(),
+		WithProject(f.project),
+		WithClientOptions(option.WithGRPCConn(conn)),
+		WithOperationTimeout(5*time.Second, time.Millisecond),
+		withInstanceGroups(f),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gke := r.(*GkeScheduler)
+	gke.retry = scheduler.RetryPolicy{Attempts: 5, Delay: time.Millisecond, Retryable: isRetryable}
+	gke.waiter.retry = gke.retry
+	return gke
+}
+
+// cluster returns cluster by resource name: projects/*/locations/*/clusters/*
+func (f *fakeGke) cluster(name string) (*containerpb.Cluster, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) < 6 || parts[1] != f.project {
+		return nil, status.Errorf(codes.NotFound, "cluster %s not found", name)
+	}
+	for _, c := range f.clusters {
+		if c.Location == parts[3] && c.Name == parts[5] {
+			return c, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "cluster %s not found", name)
+}
+
+// nodePool returns node pool by resource name: projects/*/locations/*/clusters/*/nodePools/*
+func (f *fakeGke) nodePool(name string) (*containerpb.Cluster, *containerpb.NodePool, error) {
+	c, err := f.cluster(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) == 8 {
+		for _, np := range c.NodePools {
+			if np.Name == parts[7] {
+				return c, np, nil
+			}
+		}
+	}
+	return nil, nil, status.Errorf(codes.NotFound, "node pool %s not found", name)
+}
+
+// startOperation starts long-running operation on cluster, rejecting concurrent operations like GKE does
+func (f *fakeGke) startOperation(c *containerpb.Cluster, opType containerpb.Operation_Type) (*containerpb.Operation, error) {
+	f.calls++
+	if f.busy > 0 {
+		f.busy--
+		return nil, status.Error(codes.FailedPrecondition, "Cluster is running incompatible operation operation-external.")
+	}
+	for name, op := range f.operations {
+		if op.cluster == c.Name && op.op.Status != containerpb.Operation_DONE {
+			return nil, status.Errorf(codes.FailedPrecondition, "Cluster is running incompatible operation %s.", name)
+		}
+	}
+	op := &containerpb.Operation{
+		Name:          fmt.Sprintf("operation-%d", len(f.operations)+1),
+		OperationType: opType,
+		Status:        containerpb.Operation_RUNNING,
+		Location:      c.Location,
+	}
+	f.operations[op.Name] = &fakeOperation{op: op, cluster: c.Name, polls: f.polls}
+	return proto.Clone(op).(*containerpb.Operation), nil
+}
+
+func (f *fakeGke) ListClusters(_ context.Context, req *containerpb.ListClustersRequest) (*containerpb.ListClustersResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(req.Parent, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[2] != "locations" || parts[3] != "-" {
+		return nil, status.Errorf(codes.InvalidArgument, "unexpected parent %s", req.Parent)
+	}
+	clusters := f.clusters
+	if parts[1] != f.project {
+		var ok bool
+		if clusters, ok = f.others[parts[1]]; !ok {
+			return nil, status.Errorf(codes.PermissionDenied, "no access to project %s", parts[1])
+		}
+	}
+	resp := &containerpb.ListClustersResponse{}
+	for _, c := range clusters {
+		resp.Clusters = append(resp.Clusters, proto.Clone(c).(*containerpb.Cluster))
+	}
+	return resp, nil
+}
+
+func (f *fakeGke) SetLabels(_ context.Context, req *containerpb.SetLabelsRequest) (*containerpb.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, err := f.cluster(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if req.LabelFingerprint != c.LabelFingerprint {
+		return nil, status.Error(codes.FailedPrecondition, "Labels could not be set due to fingerprint mismatch.")
+	}
+	op, err := f.startOperation(c, containerpb.Operation_UPDATE_CLUSTER)
+	if err != nil {
+		return nil, err
+	}
+	c.ResourceLabels = req.ResourceLabels
+	c.LabelFingerprint = fmt.Sprintf("fp-%d", f.calls)
+	return op, nil
+}
+
+func (f *fakeGke) SetNodePoolAutoscaling(_ context.Context, req *containerpb.SetNodePoolAutoscalingRequest) (*containerpb.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, np, err := f.nodePool(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if a := req.Autoscaling; a.Enabled && (a.MinNodeCount > a.MaxNodeCount || a.MaxNodeCount < 1) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid autoscaling range %d-%d", a.MinNodeCount, a.MaxNodeCount)
+	}
+	op, err := f.startOperation(c, containerpb.Operation_SET_NODE_POOL_MANAGEMENT)
+	if err != nil {
+		return nil, err
+	}
+	np.Autoscaling = req.Autoscaling
+	return op, nil
+}
+
+func (f *fakeGke) SetNodePoolSize(_ context.Context, req *containerpb.SetNodePoolSizeRequest) (*containerpb.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, np, err := f.nodePool(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	op, err := f.startOperation(c, containerpb.Operation_SET_NODE_POOL_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	np.InitialNodeCount = req.NodeCount
+	for _, url := range np.InstanceGroupUrls {
+		f.groups[url] = req.NodeCount
+	}
+	return op, nil
+}
+
+func (f *fakeGke) GetOperation(_ context.Context, req *containerpb.GetOperationRequest) (*containerpb.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(req.Name, "/")
+	op, ok := f.operations[parts[len(parts)-1]]
+	if !ok || parts[1] != f.project {
+		return nil, status.Errorf(codes.NotFound, "operation %s not found", req.Name)
+	}
+	if op.polls--; op.polls <= 0 {
+		op.op.Status = containerpb.Operation_DONE
+	}
+	return proto.Clone(op.op).(*containerpb.Operation), nil
+}
+
+func (f *fakeGke) CancelOperation(_ context.Context, req *containerpb.CancelOperationRequest) (*empty.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := strings.Split(req.Name, "/")
+	op, ok := f.operations[parts[len(parts)-1]]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "operation %s not found", req.Name)
+	}
+	op.op.Status = containerpb.Operation_DONE
+	op.op.StatusMessage = "Operation was canceled"
+	return &empty.Empty{}, nil
+}
+
+// Size implements instanceGroups
+func (f *fakeGke) Size(_ context.Context, url string) (int32, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.groupErr != nil {
+		return 0, f.groupErr
+	}
+	size, ok := f.groups[url]
+	if !ok {
+		return 0, &googleapi.Error{Code: http.StatusNotFound, Message: "instance group not found"}
+	}
+	return size, nil
+}
+
+// Resize implements instanceGroups
+func (f *fakeGke) Resize(_ context.Context, url string, size int32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.groups[url]; !ok {
+		return &googleapi.Error{Code: http.StatusNotFound, Message: "instance group not found"}
+	}
+	f.resizes++
+	f.groups[url] = size
+	return nil
+}
@@ -2,12 +2,17 @@ package gke
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"sort"
 	"time"
 
 	container "cloud.google.com/go/container/apiv1"
 	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"github.com/doitintl/cluster-scheduler/internal/scheduler/kube"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"k8s.io/client-go/kubernetes"
 
 	log "github.com/sirupsen/logrus"
 	containerpb "google.golang.org/genproto/googleapis/container/v1"
@@ -15,44 +20,162 @@ import (
 	"github.com/pkg/errors"
 )
 
-const (
-	default_OPERATION_TIMEOUT = time.Minute * 15
-	default_OPERATION_CHECK   = time.Second * 15
-)
-
 type GkeScheduler struct {
 	project string
-	cm      *container.ClusterManagerClient
+	cm      clusterManager
+	retry   scheduler.RetryPolicy
+	waiter  *operationWaiter
+	store   scheduler.BackupStore
+	// calendars referenced by 'cs-calendar' label
+	calendars scheduler.Calendars
+	// node pool managed instance groups
+	ig instanceGroups
+	// ClusterManager client options
+	clientOptions []option.ClientOption
+	// max time to drain node pool nodes before stop; drain is disabled when 0
+	drain time.Duration
+	// Kubernetes API client of cluster
+	kube func(context.Context, scheduler.Cluster) (kubernetes.Interface, error)
+}
+
+// Option configures GkeScheduler
+type Option func(*GkeScheduler)
+
+// WithOperationTimeout sets max time to wait for GKE operation and interval between operation status checks
+func WithOperationTimeout(timeout, poll time.Duration) Option {
+	return func(gke *GkeScheduler) {
+		gke.waiter.Timeout = timeout
+		gke.waiter.Poll = poll
+	}
+}
+
+// WithProject sets GCP project; by default, project of default credentials is used
+func WithProject(project string) Option {
+	return func(gke *GkeScheduler) {
+		gke.project = project
+	}
+}
+
+// WithClientOptions sets ClusterManager client options (e.g. endpoint or gRPC connection)
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(gke *GkeScheduler) {
+		gke.clientOptions = append(gke.clientOptions, opts...)
+	}
+}
+
+// WithBackupStore sets node pools backup store; by default, backups are stored in cluster labels
+func WithBackupStore(store scheduler.BackupStore) Option {
+	return func(gke *GkeScheduler) {
+		gke.store = store
+	}
+}
+
+// WithCalendars sets holiday and blackout calendars referenced by 'cs-calendar' label
+func WithCalendars(calendars scheduler.Calendars) Option {
+	return func(gke *GkeScheduler) {
+		gke.calendars = calendars
+	}
+}
+
+// WithDrain enables node pool drain before stop: cordon nodes and evict pods, respecting PodDisruptionBudgets,
+// waiting up to timeout for pods eviction
+func WithDrain(timeout time.Duration) Option {
+	return func(gke *GkeScheduler) {
+		gke.drain = timeout
+	}
+}
+
+// withKubeClient sets Kubernetes API client factory (fake in tests)
+func withKubeClient(fn func(context.Context, scheduler.Cluster) (kubernetes.Interface, error)) Option {
+	return func(gke *GkeScheduler) {
+		gke.kube = fn
+	}
+}
+
+// withInstanceGroups sets Compute Engine instance groups client (fake in tests)
+func withInstanceGroups(ig instanceGroups) Option {
+	return func(gke *GkeScheduler) {
+		gke.ig = ig
+	}
 }
 
-func NewGkeScheduler(ctx context.Context) (scheduler.Runner, error) {
+func newGkeScheduler(opts ...Option) *GkeScheduler {
+	retry := scheduler.NewRetryPolicy(isRetryable)
+	gke := &GkeScheduler{
+		retry:  retry,
+		waiter: &operationWaiter{retry: retry, Poll: default_OPERATION_CHECK, Timeout: default_OPERATION_TIMEOUT},
+		store:  scheduler.LabelStore{},
+		kube:   newKubeClient,
+	}
+	for _, opt := range opts {
+		opt(gke)
+	}
+	return gke
+}
+
+func NewGkeScheduler(ctx context.Context, opts ...Option) (scheduler.Runner, error) {
 	// handle the 'refresh token' command
 	cx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	creds, err := google.FindDefaultCredentials(cx)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to find default credentials")
+	gke := newGkeScheduler(opts...)
+	if gke.project == "" {
+		creds, err := google.FindDefaultCredentials(cx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find default credentials")
+		}
+		gke.project = creds.ProjectID
 	}
 
-	cm, err := container.NewClusterManagerClient(cx)
+	cm, err := container.NewClusterManagerClient(cx, gke.clientOptions...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create cluster manager client")
 	}
-	return &GkeScheduler{creds.ProjectID, cm}, nil
+	// disable default gax retries (ListClusters, GetOperation, ...): retries are done by scheduler retry policy only
+	cm.CallOptions = &container.ClusterManagerCallOptions{}
+	gke.cm, gke.waiter.cm = cm, cm
+	if gke.ig == nil {
+		// not bound to cx: the client keeps refreshing tokens after constructor returns
+		if gke.ig, err = newComputeInstanceGroups(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return gke, nil
 }
 
+// List lists clusters of default project
 func (gke *GkeScheduler) List(ctx context.Context) ([]scheduler.Cluster, error) {
+	return gke.ListProjects(ctx, []string{gke.project})
+}
+
+// ListProjects lists clusters of projects
+func (gke *GkeScheduler) ListProjects(ctx context.Context, projects []string) ([]scheduler.Cluster, error) {
 	// handle the 'refresh token' command
 	cx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	var clusters []scheduler.Cluster
+	for _, project := range projects {
+		list, err := gke.listProject(cx, project)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list clusters of project %s", project)
+		}
+		clusters = append(clusters, list...)
+	}
+	return clusters, nil
+}
+
+func (gke *GkeScheduler) listProject(cx context.Context, project string) ([]scheduler.Cluster, error) {
 	req := &containerpb.ListClustersRequest{
-		Parent: fmt.Sprintf("projects/%s/locations/-", gke.project), // all regions and zones
+		Parent: fmt.Sprintf("projects/%s/locations/-", project), // all regions and zones
 	}
-	resp, err := gke.cm.ListClusters(cx, req)
+	var resp *containerpb.ListClustersResponse
+	err := gke.retry.Do(cx, "ListClusters", func() (err error) {
+		resp, err = gke.cm.ListClusters(cx, req)
+		return err
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to list clusters")
+		return nil, err
 	}
 
 	var clusters []scheduler.Cluster
@@ -65,35 +188,103 @@ func (gke *GkeScheduler) List(ctx context.Context) ([]scheduler.Cluster, error)
 		cluster := scheduler.Cluster{
 			Name:        r.Name,
 			Location:    r.Location,
-			Project:     gke.project,
+			Project:     project,
 			Status:      r.ResourceLabels[scheduler.STATUS_LABEL],
 			Labels:      r.ResourceLabels,
 			Fingerprint: r.LabelFingerprint,
+			Endpoint:    r.Endpoint,
 		}
-		// get cluster uptime - time it is supposed to run
-		uptime, err := scheduler.ParseUptime(r.ResourceLabels[scheduler.UPTIME_LABEL])
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to parse cluster uptime range")
-		}
-		cluster.Uptime = *uptime
-		// scan node pools
-		for _, np := range r.NodePools {
-			group := scheduler.NodeGroup{
-				Name:      np.Name,
-				NodeCount: np.InitialNodeCount,
-			}
-			if np.Autoscaling != nil {
-				group.Autoscaling = np.Autoscaling.Enabled
-				group.MinNodeCount = np.Autoscaling.MinNodeCount
-				group.MaxNodeCount = np.Autoscaling.MaxNodeCount
+		if err = gke.readCluster(cx, r, &cluster); err != nil {
+			if cx.Err() != nil {
+				return nil, err
 			}
-			cluster.Nodes = append(cluster.Nodes, group)
+			// keep listing other clusters: cluster with error is reported as failed
+			log.WithError(err).WithField("cluster", r.Name).Warn("failed to read cluster")
+			cluster.Err = err
 		}
 		clusters = append(clusters, cluster)
 	}
 	return clusters, nil
 }
 
+// readCluster reads cluster CA certificate, schedule, node pools with their current size, stop policies and own schedules
+func (gke *GkeScheduler) readCluster(ctx context.Context, r *containerpb.Cluster, c *scheduler.Cluster) (err error) {
+	if r.MasterAuth != nil && r.MasterAuth.ClusterCaCertificate != "" {
+		if c.CACert, err = base64.StdEncoding.DecodeString(r.MasterAuth.ClusterCaCertificate); err != nil {
+			return errors.Wrap(err, "failed to decode cluster CA certificate")
+		}
+	}
+	// get cluster schedule - time it is supposed to run
+	schedule, err := scheduler.ParseSchedule(r.ResourceLabels, gke.calendars)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse cluster schedule")
+	}
+	c.Schedule = *schedule
+	// scan node pools
+	labels := make(map[string]map[string]string, len(r.NodePools))
+	for _, np := range r.NodePools {
+		group := scheduler.NodeGroup{
+			Name:      np.Name,
+			NodeCount: np.InitialNodeCount,
+		}
+		if err = gke.readZones(ctx, np, &group); err != nil {
+			if ctx.Err() != nil {
+				return errors.Wrapf(err, "failed to get node pool %s size", np.Name)
+			}
+			// e.g. missing compute.instanceGroupManagers.get permission: keep the node pool manageable
+			log.WithError(err).WithFields(log.Fields{"cluster": r.Name, "node pool": np.Name}).Warn("failed to read node pool size from instance groups, using initial node count")
+			group.NodeCount, group.Zones, group.InstanceGroups = np.InitialNodeCount, nil, nil
+		}
+		if np.Autoscaling != nil {
+			group.Autoscaling = np.Autoscaling.Enabled
+			group.MinNodeCount = np.Autoscaling.MinNodeCount
+			group.MaxNodeCount = np.Autoscaling.MaxNodeCount
+		}
+		if np.Config != nil {
+			labels[np.Name] = np.Config.Labels
+		}
+		c.Nodes = append(c.Nodes, group)
+	}
+	// node pool stop policy and own schedule
+	if err = c.ParseNodeGroups(labels, gke.calendars); err != nil {
+		return errors.Wrap(err, "failed to parse node pools")
+	}
+	return nil
+}
+
+// readZones reads current node count per zone from node pool instance groups: InitialNodeCount is the
+// per-zone count at node pool creation, while autoscaler or manual resize can change size of each zone;
+// node group NodeCount is set to the largest per-zone count
+func (gke *GkeScheduler) readZones(ctx context.Context, np *containerpb.NodePool, group *scheduler.NodeGroup) error {
+	if len(np.InstanceGroupUrls) == 0 {
+		return nil
+	}
+	group.NodeCount = 0
+	group.Zones = make(map[string]int32, len(np.InstanceGroupUrls))
+	group.InstanceGroups = make(map[string]string, len(np.InstanceGroupUrls))
+	for _, url := range np.InstanceGroupUrls {
+		_, zone, _, err := parseInstanceGroupURL(url)
+		if err != nil {
+			return err
+		}
+		var size int32
+		err = gke.retry.Do(ctx, "GetInstanceGroupManager", func() (err error) {
+			size, err = gke.ig.Size(ctx, url)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		// node pool can have multiple instance groups per zone
+		group.Zones[zone] += size
+		group.InstanceGroups[zone] = url
+		if group.Zones[zone] > group.NodeCount {
+			group.NodeCount = group.Zones[zone]
+		}
+	}
+	return nil
+}
+
 // Stop node pool: disable autoscaling and resize to 0
 func (gke *GkeScheduler) Stop(ctx context.Context, cluster scheduler.Cluster) error {
 	log.WithFields(log.Fields{
@@ -102,81 +293,47 @@ func (gke *GkeScheduler) Stop(ctx context.Context, cluster scheduler.Cluster) er
 		"location": cluster.Location,
 		"status":   cluster.Status,
 	}).Info("stopping cluster")
-	// check cluster status
-	if cluster.Status == scheduler.STATUS_DOWN {
+	// check cluster and node pools status
+	if _, ok := cluster.Transition(scheduler.STATUS_DOWN); !ok {
 		log.Debug("ignore stopped cluster")
 		return nil
 	}
-	// stop cluster
-	clusterName := fmt.Sprintf("projects/%s/locations/%s/clusters/%s",
-		cluster.Project, cluster.Location, cluster.Name)
-	// prepare node pool backup labels; create/update cluster labels
-	labels := cluster.Labels
-	for _, np := range cluster.Nodes {
-		// backup node pool autoscaling and sizing as label
-		npBackup := fmt.Sprintf("%t_%d_%d_%d", np.Autoscaling, np.NodeCount, np.MinNodeCount, np.MaxNodeCount)
-		npLabel := fmt.Sprintf("cs-%s-size", np.Name)
-		labels[npLabel] = npBackup
-	}
-	// update cluster scheduler labels
-	if len(labels) > 0 {
-		labels[scheduler.STATUS_LABEL] = scheduler.STATUS_DOWN
-		reqStatusLabel := &containerpb.SetLabelsRequest{
-			Name:             clusterName,
-			ResourceLabels:   labels,
-			LabelFingerprint: cluster.Fingerprint,
-		}
-		log.Debug("backup nodepools configuration as cluster labels")
-		op, err := gke.cm.SetLabels(ctx, reqStatusLabel)
-		if err != nil {
-			return errors.Wrap(err, "failed to update cluster labels")
-		}
-		err = gke.waitForOperation(ctx, cluster.Project, cluster.Location, op)
-		if err != nil {
-			return errors.Wrap(err, "failed to complete 'SetLabels' operation")
-		}
+	plan, err := gke.PlanStop(ctx, cluster)
+	if err != nil {
+		return err
 	}
-	// update cluster node pools:
-	// 1. disable autoscaling
-	// 2. set size to 0
-	for _, np := range cluster.Nodes {
-		nodePoolName := fmt.Sprintf("%s/nodePools/%s", clusterName, np.Name)
-		// set node pool autoscaling to false
-		log.WithFields(log.Fields{
-			"cluster":   cluster.Name,
-			"node-pool": np.Name,
-		}).Debug("disabling nodepool autoscaling")
-		reqAutoscaling := &containerpb.SetNodePoolAutoscalingRequest{
-			Name:        nodePoolName,
-			Autoscaling: &containerpb.NodePoolAutoscaling{Enabled: false},
-		}
-		op, err := gke.cm.SetNodePoolAutoscaling(ctx, reqAutoscaling)
-		if err != nil {
-			return errors.Wrap(err, "failed to disable node pool autoscaling")
-		}
-		err = gke.waitForOperation(ctx, cluster.Project, cluster.Location, op)
-		if err != nil {
-			return errors.Wrap(err, "failed to complete 'SetNodePoolAutoscaling' operation")
-		}
-		// resize node pool size to 0
-		log.WithFields(log.Fields{
-			"cluster":   cluster.Name,
-			"node-pool": np.Name,
-		}).Debug("resizing nodepool size to 0")
-		reqSize := &containerpb.SetNodePoolSizeRequest{
-			Name:      nodePoolName,
-			NodeCount: 0,
-		}
-		op, err = gke.cm.SetNodePoolSize(ctx, reqSize)
-		if err != nil {
-			return errors.Wrap(err, "failed to set node pool size to 0")
-		}
-		err = gke.waitForOperation(ctx, cluster.Project, cluster.Location, op)
-		if err != nil {
-			return errors.Wrap(err, "failed to complete 'SetNodePoolSize' operation")
+	return gke.apply(ctx, plan)
+}
+
+// PlanStop plans node pools stop:
+// 1. backup node pool autoscaling and sizing in backup store (cluster labels by default)
+// 2. disable autoscaling
+// 3. drain nodes, if enabled and node pool is scaled to 0
+// 4. set size to 0 or to number of nodes to keep (per zone)
+// node pools with 'skip' stop policy are left as is; already stopped node pools are ignored
+func (gke *GkeScheduler) PlanStop(_ context.Context, cluster scheduler.Cluster) (*scheduler.Plan, error) {
+	cluster, ok := cluster.Transition(scheduler.STATUS_DOWN)
+	plan := &scheduler.Plan{Cluster: cluster, Status: scheduler.STATUS_DOWN}
+	if !ok {
+		return plan, nil
+	}
+	labels, err := scheduler.PlanBackup(plan, gke.store, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to backup node pools")
+	}
+	for k, v := range cluster.StatusLabels(scheduler.STATUS_DOWN) {
+		labels[k] = v
+	}
+	plan.Add(scheduler.Operation{Type: scheduler.OP_SET_LABELS, Labels: labels})
+	for _, np := range cluster.StoppedNodeGroups() {
+		size, _ := np.StopSize()
+		plan.Add(scheduler.Operation{Type: scheduler.OP_SET_AUTOSCALING, NodeGroup: np.Name})
+		if gke.drain > 0 && size == 0 {
+			plan.Add(scheduler.Operation{Type: scheduler.OP_DRAIN, NodeGroup: np.Name})
 		}
+		plan.Add(scheduler.Operation{Type: scheduler.OP_SET_SIZE, NodeGroup: np.Name, NodeCount: size})
 	}
-	return nil
+	return plan, nil
 }
 
 func (gke *GkeScheduler) Restart(ctx context.Context, cluster scheduler.Cluster) error {
@@ -186,139 +343,260 @@ func (gke *GkeScheduler) Restart(ctx context.Context, cluster scheduler.Cluster)
 		"location": cluster.Location,
 		"status":   cluster.Status,
 	}).Info("restarting cluster")
-	// check cluster status
-	if cluster.Status == scheduler.STATUS_UP {
+	// check cluster and node pools status
+	if _, ok := cluster.Transition(scheduler.STATUS_UP); !ok {
 		log.Debug("ignore already running cluster")
 		return nil
 	}
-	// restart cluster
-	clusterName := fmt.Sprintf("projects/%s/locations/%s/clusters/%s",
-		cluster.Project, cluster.Location, cluster.Name)
-	// update cluster node pools:
-	// 1. restore autoscaling
-	// 2. update nodepool size to min and max
-	for _, np := range cluster.Nodes {
-		nodePoolName := fmt.Sprintf("%s/nodePools/%s", clusterName, np.Name)
-		upNodePool, err := scheduler.Restore(
-			np.Name, cluster.Labels[scheduler.GetBackupLabel(np.Name)])
-		if err != nil {
-			return errors.Wrap(err, "failed to read backup from label")
-		}
-		// set node pool autoscaling to false
-		log.WithFields(log.Fields{
-			"cluster":   cluster.Name,
-			"node-pool": np.Name,
-		}).Debug("restoring nodepool autoscaling")
-		reqAutoscaling := &containerpb.SetNodePoolAutoscalingRequest{
-			Name: nodePoolName,
-			Autoscaling: &containerpb.NodePoolAutoscaling{
-				Enabled:      upNodePool.Autoscaling,
-				MinNodeCount: upNodePool.MinNodeCount,
-				MaxNodeCount: upNodePool.MaxNodeCount,
-			},
+	plan, err := gke.PlanRestart(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return gke.apply(ctx, plan)
+}
+
+// PlanRestart plans restart of stopped node pools from the latest backup
+func (gke *GkeScheduler) PlanRestart(ctx context.Context, cluster scheduler.Cluster) (*scheduler.Plan, error) {
+	stopped, ok := cluster.Transition(scheduler.STATUS_UP)
+	if !ok {
+		return &scheduler.Plan{Cluster: cluster, Status: scheduler.STATUS_UP}, nil
+	}
+	return gke.PlanRestore(ctx, stopped, "")
+}
+
+// Restore node pools to backup snapshot
+func (gke *GkeScheduler) Restore(ctx context.Context, cluster scheduler.Cluster, snapshot string) error {
+	log.WithFields(log.Fields{
+		"cluster":  cluster.Name,
+		"project":  cluster.Project,
+		"location": cluster.Location,
+		"status":   cluster.Status,
+		"snapshot": snapshot,
+	}).Info("restoring cluster")
+	plan, err := gke.PlanRestore(ctx, cluster, snapshot)
+	if err != nil {
+		return err
+	}
+	return gke.apply(ctx, plan)
+}
+
+// PlanRestore plans node pools restore from backup snapshot:
+// 1. restore autoscaling
+// 2. restore node pool size
+// 3. update cluster scheduler status labels
+func (gke *GkeScheduler) PlanRestore(ctx context.Context, cluster scheduler.Cluster, snapshot string) (*scheduler.Plan, error) {
+	plan := &scheduler.Plan{Cluster: cluster, Status: scheduler.STATUS_UP}
+	nodePools := cluster.StoppedNodeGroups()
+	var backup *scheduler.ClusterBackup
+	if len(nodePools) > 0 {
+		var err error
+		if backup, err = scheduler.LoadBackup(ctx, gke.store, cluster, snapshot); err != nil {
+			return nil, errors.Wrap(err, "failed to load node pools backup")
 		}
-		op, err := gke.cm.SetNodePoolAutoscaling(ctx, reqAutoscaling)
+	}
+	for _, np := range nodePools {
+		upNodePool, err := backup.NodeGroup(np.Name)
 		if err != nil {
-			return errors.Wrap(err, "failed to restore node pool autoscaling")
+			return nil, err
 		}
-		err = gke.waitForOperation(ctx, cluster.Project, cluster.Location, op)
-		if err != nil {
-			return errors.Wrap(err, "failed to complete 'SetNodePoolAutoscaling' operation")
+		plan.Add(scheduler.Operation{
+			Type:         scheduler.OP_SET_AUTOSCALING,
+			NodeGroup:    np.Name,
+			Autoscaling:  upNodePool.Autoscaling,
+			MinNodeCount: upNodePool.MinNodeCount,
+			MaxNodeCount: upNodePool.MaxNodeCount,
+		})
+		if zones := zoneSizes(np, upNodePool); zones != nil {
+			for _, op := range zones {
+				plan.Add(op)
+			}
+			continue
 		}
-		// resize node pool size to 0
-		log.WithFields(log.Fields{
-			"cluster":   cluster.Name,
-			"node-pool": np.Name,
-		}).Debug("restoring nodepool size")
-		reqSize := &containerpb.SetNodePoolSizeRequest{
-			Name:      nodePoolName,
+		plan.Add(scheduler.Operation{
+			Type:      scheduler.OP_SET_SIZE,
+			NodeGroup: np.Name,
 			NodeCount: upNodePool.NodeCount,
-		}
-		op, err = gke.cm.SetNodePoolSize(ctx, reqSize)
-		if err != nil {
-			return errors.Wrap(err, "failed to restore node pool size")
-		}
-		err = gke.waitForOperation(ctx, cluster.Project, cluster.Location, op)
-		if err != nil {
-			return errors.Wrap(err, "failed to complete 'SetNodePoolSize' operation")
+		})
+	}
+	plan.Add(scheduler.Operation{
+		Type:   scheduler.OP_SET_LABELS,
+		Labels: cluster.StatusLabels(scheduler.STATUS_UP),
+	})
+	return plan, nil
+}
+
+// zoneSizes returns operations resizing node pool zones one by one, when backup has different node counts
+// per zone (SetNodePoolSize sets the same count in all zones); nil if zones have the same node count or
+// some zone has no instance group anymore
+func zoneSizes(current scheduler.NodeGroup, backup *scheduler.NodeGroup) []scheduler.Operation {
+	uneven := false
+	for _, count := range backup.Zones {
+		if count != backup.NodeCount {
+			uneven = true
 		}
 	}
-	// update cluster scheduler status label
-	labels := cluster.Labels
-	labels[scheduler.STATUS_LABEL] = scheduler.STATUS_UP
-	reqStatusLabel := &containerpb.SetLabelsRequest{
-		Name:             clusterName,
-		ResourceLabels:   labels,
-		LabelFingerprint: cluster.Fingerprint,
+	if !uneven {
+		return nil
 	}
-	log.Debug("updating cluster scheduler status")
-	op, err := gke.cm.SetLabels(ctx, reqStatusLabel)
-	if err != nil {
-		return errors.Wrap(err, "failed to update cluster scheduler status")
+	zones := make([]string, 0, len(backup.Zones))
+	for zone := range backup.Zones {
+		if _, ok := current.InstanceGroups[zone]; !ok {
+			return nil
+		}
+		zones = append(zones, zone)
 	}
-	err = gke.waitForOperation(ctx, cluster.Project, cluster.Location, op)
-	if err != nil {
-		return errors.Wrap(err, "failed to complete 'SetLabels' operation")
+	sort.Strings(zones)
+	ops := make([]scheduler.Operation, 0, len(zones))
+	for _, zone := range zones {
+		ops = append(ops, scheduler.Operation{
+			Type:      scheduler.OP_SET_ZONE_SIZE,
+			NodeGroup: current.Name,
+			Zone:      zone,
+			NodeCount: backup.Zones[zone],
+		})
 	}
-	return nil
+	return ops
 }
 
-func (gke *GkeScheduler) DecideOnStatus(cluster scheduler.Cluster) error {
-	if cluster.Uptime.IsInRange(time.Now()) {
-		fmt.Println("пусть себе бежит...")
-		return nil
+// apply executes planned operations one by one, waiting for each operation to complete
+func (gke *GkeScheduler) apply(ctx context.Context, plan *scheduler.Plan) error {
+	for _, planned := range plan.Operations {
+		if err := gke.execute(ctx, plan.Cluster, planned); err != nil {
+			return scheduler.NodeGroupFailure(planned.NodeGroup, err)
+		}
 	}
-	fmt.Println("убить нах!")
 	return nil
 }
 
-func (gke *GkeScheduler) waitForOperation(ctx context.Context, project, location string, op *containerpb.Operation) error {
-	// check if operation is completed
-	if op == nil || op.Status == containerpb.Operation_DONE {
+// execute executes planned operation and waits for it to complete
+func (gke *GkeScheduler) execute(ctx context.Context, cluster scheduler.Cluster, planned scheduler.Operation) error {
+	var op *containerpb.Operation
+	var err error
+	clusterName := fmt.Sprintf("projects/%s/locations/%s/clusters/%s",
+		cluster.Project, cluster.Location, cluster.Name)
+	nodePoolName := fmt.Sprintf("%s/nodePools/%s", clusterName, planned.NodeGroup)
+	logger := log.WithFields(log.Fields{
+		"cluster":   cluster.Name,
+		"node-pool": planned.NodeGroup,
+	})
+	switch planned.Type {
+	case scheduler.OP_SAVE_BACKUP:
+		logger.Debug("saving node pools backup")
+		return errors.Wrap(gke.store.Save(ctx, planned.Backup), "failed to save node pools backup")
+	case scheduler.OP_DRAIN:
+		logger.Debug("draining nodepool")
+		// drain is best effort: node pool is stopped anyway
+		if err = gke.drainNodePool(ctx, cluster, planned.NodeGroup); err != nil {
+			logger.WithError(err).Warn("failed to drain nodepool")
+		}
 		return nil
-	}
-	// wait for operation to be completed (or timeout/error)
-	timer := time.NewTimer(default_OPERATION_TIMEOUT)
-	done := make(chan int)
-	errCh := make(chan error)
-	go func(project, location, name string) {
-		// periodically check operation status (first tick after 10ms)
-		ticker := time.NewTicker(default_OPERATION_CHECK)
-		for ; true; <-ticker.C {
-			opReq := &containerpb.GetOperationRequest{
-				Name: fmt.Sprintf("projects/%s/locations/%s/operations/%s", project, location, name),
-			}
-			log.WithFields(log.Fields{}).Debug("get operation status")
-			op, err := gke.cm.GetOperation(ctx, opReq)
-			if err != nil {
-				errCh <- err
-				break
-			}
-			if op.Status == containerpb.Operation_DONE {
-				done <- 1
-				ticker.Stop()
-				break
-			}
+	case scheduler.OP_SET_LABELS:
+		// create/update cluster labels
+		labels := make(map[string]string, len(cluster.Labels)+len(planned.Labels))
+		for k, v := range cluster.Labels {
+			labels[k] = v
 		}
-	}(project, location, op.Name)
-	select {
-	case <-done:
-		// operation successfully completed
-		log.WithField("operation", op).Debug("successfully completed operation")
-		timer.Stop()
-	case err := <-errCh:
-		// error from error channel
-		return errors.Wrap(err, "failed to get operation")
-	case <-timer.C:
-		// cancel operation on timeout
-		cancelReq := &containerpb.CancelOperationRequest{
-			Name: fmt.Sprintf("projects/%s/locations/%s/operations/%s", project, op.Location, op.Name),
+		for k, v := range planned.Labels {
+			labels[k] = v
+		}
+		logger.Debug("updating cluster scheduler labels")
+		err = gke.retry.Do(ctx, "SetLabels", func() (err error) {
+			op, err = gke.cm.SetLabels(ctx, &containerpb.SetLabelsRequest{
+				Name:             clusterName,
+				ResourceLabels:   labels,
+				LabelFingerprint: cluster.Fingerprint,
+			})
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to update cluster labels")
+		}
+	case scheduler.OP_SET_AUTOSCALING:
+		logger.WithField("autoscaling", planned.Autoscaling).Debug("setting nodepool autoscaling")
+		err = gke.retry.Do(ctx, "SetNodePoolAutoscaling", func() (err error) {
+			op, err = gke.cm.SetNodePoolAutoscaling(ctx, &containerpb.SetNodePoolAutoscalingRequest{
+				Name: nodePoolName,
+				Autoscaling: &containerpb.NodePoolAutoscaling{
+					Enabled:      planned.Autoscaling,
+					MinNodeCount: planned.MinNodeCount,
+					MaxNodeCount: planned.MaxNodeCount,
+				},
+			})
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to set node pool autoscaling")
 		}
-		log.WithField("operation", op).Debug("canceling operation request on timeout")
-		err := gke.cm.CancelOperation(ctx, cancelReq)
+	case scheduler.OP_SET_SIZE:
+		logger.WithField("size", planned.NodeCount).Debug("resizing nodepool")
+		err = gke.retry.Do(ctx, "SetNodePoolSize", func() (err error) {
+			op, err = gke.cm.SetNodePoolSize(ctx, &containerpb.SetNodePoolSizeRequest{
+				Name:      nodePoolName,
+				NodeCount: planned.NodeCount,
+			})
+			return err
+		})
 		if err != nil {
-			return errors.Wrap(err, "failed to cancel operation request")
+			return errors.Wrapf(err, "failed to set node pool size to %d", planned.NodeCount)
 		}
+	case scheduler.OP_SET_ZONE_SIZE:
+		url := instanceGroup(cluster, planned.NodeGroup, planned.Zone)
+		if url == "" {
+			return errors.Errorf("no instance group in zone %s", planned.Zone)
+		}
+		logger.WithFields(log.Fields{
+			"zone": planned.Zone,
+			"size": planned.NodeCount,
+		}).Debug("resizing nodepool instance group")
+		err = gke.retry.Do(ctx, "ResizeInstanceGroupManager", func() error {
+			return gke.ig.Resize(ctx, url, planned.NodeCount)
+		})
+		return errors.Wrapf(err, "failed to set node pool size in zone %s to %d", planned.Zone, planned.NodeCount)
+	default:
+		return errors.Errorf("unsupported operation '%s'", planned.Type)
 	}
-	return nil
+	err = gke.waiter.Wait(ctx, cluster.Project, cluster.Location, op)
+	return errors.Wrapf(err, "failed to complete '%s' operation", planned.Type)
+}
+
+// instanceGroup returns URL of node pool instance group in zone
+func instanceGroup(cluster scheduler.Cluster, nodePool, zone string) string {
+	for _, np := range cluster.Nodes {
+		if np.Name == nodePool {
+			return np.InstanceGroups[zone]
+		}
+	}
+	return ""
+}
+
+// drainNodePool cordons node pool nodes and evicts their pods
+func (gke *GkeScheduler) drainNodePool(ctx context.Context, cluster scheduler.Cluster, nodePool string) error {
+	client, err := gke.kube(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	drainer := &kube.Drainer{Client: client, Timeout: gke.drain}
+	return drainer.Drain(ctx, kube.GKE_NODE_POOL_LABEL+"="+nodePool)
+}
+
+// Protected returns protected workloads (running Jobs and keep-alive pods) on cluster node pools to stop
+func (gke *GkeScheduler) Protected(ctx context.Context, cluster scheduler.Cluster) ([]string, error) {
+	nodePools := cluster.StoppedNodeGroups()
+	if len(nodePools) == 0 {
+		return nil, nil
+	}
+	client, err := gke.kube(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return kube.ProtectedWorkloads(ctx, client, kube.NodeGroupSelector(kube.GKE_NODE_POOL_LABEL, nodePools))
+}
+
+// newKubeClient returns Kubernetes API client of GKE cluster, authenticated with default credentials
+func newKubeClient(ctx context.Context, cluster scheduler.Cluster) (kubernetes.Interface, error) {
+	ts, err := google.DefaultTokenSource(ctx, container.DefaultAuthScopes()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find default credentials")
+	}
+	return kube.NewClient(cluster.Endpoint, cluster.CACert, ts)
 }
@@ -0,0 +1,674 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"github.com/doitintl/cluster-scheduler/internal/scheduler/kube"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	containerpb "google.golang.org/genproto/googleapis/container/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testClusters() []*containerpb.Cluster {
+	return []*containerpb.Cluster{
+		{
+			Name:     "dev",
+			Location: "us-central1",
+			ResourceLabels: map[string]string{
+				scheduler.ENABLED_LABEL: "true",
+				scheduler.UPTIME_LABEL:  "8-19_1-5_x_x",
+			},
+			NodePools: []*containerpb.NodePool{
+				{Name: "default", InitialNodeCount: 2},
+				{Name: "workers", InitialNodeCount: 3, Autoscaling: &containerpb.NodePoolAutoscaling{Enabled: true, MinNodeCount: 1, MaxNodeCount: 5}},
+			},
+		},
+		{
+			Name:      "prod",
+			Location:  "us-central1-a",
+			NodePools: []*containerpb.NodePool{{Name: "default", InitialNodeCount: 3}},
+		},
+	}
+}
+
+func TestGkeScheduler_StopRestart(t *testing.T) {
+	f := newFakeGke("demo", testClusters()...)
+	gke := f.start(t)
+	ctx := context.Background()
+
+	clusters, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(clusters) != 1 || clusters[0].Name != "dev" || clusters[0].Project != "demo" {
+		t.Fatalf("List() = %v, want only 'dev' cluster", clusters)
+	}
+	if got := len(clusters[0].Nodes); got != 2 {
+		t.Fatalf("List() nodes = %v, want 2 node pools", clusters[0].Nodes)
+	}
+
+	// stop: backup in labels, disable autoscaling and resize to 0
+	if err = gke.Stop(ctx, clusters[0]); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	dev := f.clusters[0]
+	for _, np := range dev.NodePools {
+		if np.InitialNodeCount != 0 || np.Autoscaling.Enabled {
+			t.Errorf("Stop() node pool %s = %v, want size 0 without autoscaling", np.Name, np)
+		}
+	}
+	if got := dev.ResourceLabels[scheduler.STATUS_LABEL]; got != scheduler.STATUS_DOWN {
+		t.Errorf("Stop() status label = %q, want %q", got, scheduler.STATUS_DOWN)
+	}
+	if got, err := scheduler.ParseBackupLabels("workers", dev.ResourceLabels); err != nil || !got.Autoscaling || got.NodeCount != 3 || got.MinNodeCount != 1 || got.MaxNodeCount != 5 {
+		t.Errorf("Stop() backup label = %v (error %v), want autoscaling 3[1-5]", got, err)
+	}
+	for k, v := range dev.ResourceLabels {
+		if len(v) > 63 {
+			t.Errorf("Stop() label %s value is longer than 63 characters: %q", k, v)
+		}
+	}
+	if got := dev.ResourceLabels[scheduler.UPTIME_LABEL]; got != "8-19_1-5_x_x" {
+		t.Errorf("Stop() lost uptime label, got %q", got)
+	}
+
+	// restart: restore node pools from labels
+	clusters, err = gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if err = gke.Restart(ctx, clusters[0]); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if np := dev.NodePools[0]; np.InitialNodeCount != 2 || np.Autoscaling.Enabled {
+		t.Errorf("Restart() node pool default = %v, want size 2 without autoscaling", np)
+	}
+	if a := dev.NodePools[1].Autoscaling; !a.Enabled || a.MinNodeCount != 1 || a.MaxNodeCount != 5 {
+		t.Errorf("Restart() node pool workers autoscaling = %v, want 1-5", a)
+	}
+	if got := dev.ResourceLabels[scheduler.STATUS_LABEL]; got != scheduler.STATUS_UP {
+		t.Errorf("Restart() status label = %q, want %q", got, scheduler.STATUS_UP)
+	}
+}
+
+func TestGkeScheduler_ListClusterError(t *testing.T) {
+	clusters := testClusters()
+	broken := map[string]map[string]string{
+		"bad-uptime":   {scheduler.UPTIME_LABEL: "8-25_x_x_x"},
+		"bad-calendar": {scheduler.CALENDAR_LABEL: "unknown"},
+		"bad-keep":     {"cs-keep-default": "some"},
+	}
+	for name, labels := range broken {
+		labels[scheduler.ENABLED_LABEL] = "true"
+		clusters = append(clusters, &containerpb.Cluster{
+			Name:           name,
+			Location:       "us-central1",
+			ResourceLabels: labels,
+			NodePools:      []*containerpb.NodePool{{Name: "default", InitialNodeCount: 1}},
+		})
+	}
+	f := newFakeGke("demo", clusters...)
+	gke := f.start(t)
+	ctx := context.Background()
+
+	list, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list) != 4 {
+		t.Fatalf("List() = %d clusters, want 4", len(list))
+	}
+	// evening: broken clusters fail, dev cluster is stopped
+	summary, err := scheduler.Reconcile(ctx, gke, list, time.Date(2020, 4, 15, 20, 0, 0, 0, time.UTC), scheduler.ReconcileOptions{RunOptions: scheduler.RunOptions{Concurrency: 2}})
+	if err == nil || len(summary.Failed) != len(broken) {
+		t.Errorf("Reconcile() error = %v, want %d failed clusters", err, len(broken))
+	}
+	for _, e := range summary.Failed {
+		if e.Cluster == "demo/us-central1/dev" {
+			t.Errorf("Reconcile() failed cluster %v", e)
+		}
+	}
+	if np := f.clusters[0].NodePools[0]; np.InitialNodeCount != 0 {
+		t.Errorf("Reconcile() node pool default = %v, want stopped", np)
+	}
+}
+
+func TestGkeScheduler_ListProjects(t *testing.T) {
+	f := newFakeGke("demo", testClusters()...)
+	staging := testClusters()[0]
+	staging.Name = "staging"
+	f.others = map[string][]*containerpb.Cluster{"other": {staging}}
+	gke := f.start(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		projects []string
+		want     []string
+		wantErr  bool
+	}{
+		{name: "default project", want: []string{"demo/us-central1/dev"}},
+		{name: "other project", projects: []string{"other"}, want: []string{"other/us-central1/staging"}},
+		{name: "several projects", projects: []string{"demo", "other"}, want: []string{"demo/us-central1/dev", "other/us-central1/staging"}},
+		{name: "no access", projects: []string{"secret"}, wantErr: true},
+		{name: "pattern", projects: []string{"oth*"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// '--project' flag
+			clusters, err := scheduler.ListClusters(ctx, gke, &scheduler.Filter{Projects: tt.projects})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListClusters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, c := range clusters {
+				got = append(got, c.ID())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListClusters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGkeScheduler_ConcurrentOperation(t *testing.T) {
+	f := newFakeGke("demo", testClusters()...)
+	gke := f.start(t)
+	ctx := context.Background()
+	clusters, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	// external operation is running on cluster: retry till it completes
+	f.busy = 2
+	if err = gke.Stop(ctx, clusters[0]); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if got := f.clusters[0].ResourceLabels[scheduler.STATUS_LABEL]; got != scheduler.STATUS_DOWN {
+		t.Errorf("Stop() status label = %q, want %q", got, scheduler.STATUS_DOWN)
+	}
+}
+
+func TestGkeScheduler_FingerprintMismatch(t *testing.T) {
+	f := newFakeGke("demo", testClusters()...)
+	gke := f.start(t)
+	ctx := context.Background()
+	clusters, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	// cluster labels are changed after List
+	f.clusters[0].LabelFingerprint = "fp-changed"
+	err = gke.Stop(ctx, clusters[0])
+	if status.Code(unwrap(err)) != codes.FailedPrecondition {
+		t.Fatalf("Stop() error = %v, want FailedPrecondition", err)
+	}
+	if np := f.clusters[0].NodePools[0]; np.InitialNodeCount != 2 {
+		t.Errorf("Stop() resized node pool after failed labels update: %v", np)
+	}
+}
+
+// unwrap returns the innermost error
+func unwrap(err error) error {
+	for {
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			if c, ok := err.(interface{ Cause() error }); ok {
+				err = c.Cause()
+				continue
+			}
+			return err
+		}
+		err = u.Unwrap()
+	}
+}
+
+func TestGkeScheduler_FileBackupStore(t *testing.T) {
+	f := newFakeGke("demo", testClusters()...)
+	gke := f.start(t)
+	gke.store = scheduler.FileStore{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	clusters, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if err = gke.Stop(ctx, clusters[0]); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	dev := f.clusters[0]
+	if _, ok := dev.ResourceLabels[scheduler.GetBackupLabel("workers")]; ok {
+		t.Errorf("Stop() labels = %v, want no backup labels", dev.ResourceLabels)
+	}
+	if got := dev.ResourceLabels[scheduler.STATUS_LABEL]; got != scheduler.STATUS_DOWN {
+		t.Errorf("Stop() status label = %q, want %q", got, scheduler.STATUS_DOWN)
+	}
+
+	clusters, err = gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if err = gke.Restart(ctx, clusters[0]); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if a := dev.NodePools[1].Autoscaling; !a.Enabled || a.MinNodeCount != 1 || a.MaxNodeCount != 5 {
+		t.Errorf("Restart() node pool workers autoscaling = %v, want 1-5", a)
+	}
+}
+
+func TestGkeScheduler_RestoreSnapshot(t *testing.T) {
+	f := newFakeGke("demo", testClusters()...)
+	gke := f.start(t)
+	store := scheduler.FileStore{Dir: t.TempDir()}
+	gke.store = store
+	ctx := context.Background()
+
+	clusters, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	// snapshot taken before node pool was manually changed
+	earlier := clusters[0]
+	earlier.Nodes = []scheduler.NodeGroup{
+		{Name: "default", NodeCount: 1},
+		{Name: "workers", NodeCount: 4, MinNodeCount: 2, MaxNodeCount: 8, Autoscaling: true},
+	}
+	if err = store.Save(ctx, scheduler.NewClusterBackup(earlier, time.Date(2020, 4, 15, 22, 0, 0, 0, time.UTC))); err != nil {
+		t.Fatal(err)
+	}
+	if err = gke.Stop(ctx, clusters[0]); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	backups, err := store.List(ctx, clusters[0])
+	if err != nil || len(backups) != 2 {
+		t.Fatalf("List() backups = %v (error %v), want 2 snapshots", backups, err)
+	}
+
+	clusters, err = gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if err = gke.Restore(ctx, clusters[0], "20200415-220000"); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	dev := f.clusters[0]
+	if np := dev.NodePools[0]; np.InitialNodeCount != 1 {
+		t.Errorf("Restore() node pool default = %v, want size 1", np)
+	}
+	if a := dev.NodePools[1].Autoscaling; !a.Enabled || a.MinNodeCount != 2 || a.MaxNodeCount != 8 {
+		t.Errorf("Restore() node pool workers autoscaling = %v, want 2-8", a)
+	}
+	if got := dev.ResourceLabels[scheduler.STATUS_LABEL]; got != scheduler.STATUS_UP {
+		t.Errorf("Restore() status label = %q, want %q", got, scheduler.STATUS_UP)
+	}
+	if err = gke.Restore(ctx, clusters[0], "20200101-000000"); !errors.Is(err, scheduler.ErrBackupNotFound) {
+		t.Errorf("Restore() unknown snapshot error = %v, want %v", err, scheduler.ErrBackupNotFound)
+	}
+}
+
+func TestGkeScheduler_RegionalNodePool(t *testing.T) {
+	const igm = "https://www.googleapis.com/compute/v1/projects/demo/zones/us-central1-%s/instanceGroupManagers/gke-dev-workers-grp"
+	urls := []string{fmt.Sprintf(igm, "a"), fmt.Sprintf(igm, "b"), fmt.Sprintf(igm, "c")}
+	clusters := testClusters()
+	clusters[0].NodePools[1].InstanceGroupUrls = urls
+	f := newFakeGke("demo", clusters...)
+	// autoscaler resized zones unevenly since node pool creation
+	f.groups[urls[0]], f.groups[urls[1]], f.groups[urls[2]] = 2, 4, 1
+	gke := f.start(t)
+	ctx := context.Background()
+
+	list, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	workers := list[0].Nodes[1]
+	wantZones := map[string]int32{"us-central1-a": 2, "us-central1-b": 4, "us-central1-c": 1}
+	if !reflect.DeepEqual(workers.Zones, wantZones) || workers.NodeCount != 4 {
+		t.Fatalf("List() node pool workers = %+v, want zones %v", workers, wantZones)
+	}
+	if err = gke.Stop(ctx, list[0]); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	for _, url := range urls {
+		if f.groups[url] != 0 {
+			t.Errorf("Stop() instance group %s size = %d, want 0", url, f.groups[url])
+		}
+	}
+
+	list, err = gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	plan, err := gke.PlanRestart(ctx, list[0])
+	if err != nil {
+		t.Fatalf("PlanRestart() error = %v", err)
+	}
+	var zoneOps []string
+	for _, op := range plan.Operations {
+		if op.Type == scheduler.OP_SET_ZONE_SIZE {
+			zoneOps = append(zoneOps, op.String())
+		}
+	}
+	wantOps := []string{
+		"node pool workers: set size in zone us-central1-a: 2",
+		"node pool workers: set size in zone us-central1-b: 4",
+		"node pool workers: set size in zone us-central1-c: 1",
+	}
+	if !reflect.DeepEqual(zoneOps, wantOps) {
+		t.Errorf("PlanRestart() zone operations = %v, want %v", zoneOps, wantOps)
+	}
+	if err = gke.Restart(ctx, list[0]); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	for i, want := range []int32{2, 4, 1} {
+		if got := f.groups[urls[i]]; got != want {
+			t.Errorf("Restart() instance group %s size = %d, want %d", urls[i], got, want)
+		}
+	}
+	if a := f.clusters[0].NodePools[1].Autoscaling; !a.Enabled || a.MinNodeCount != 1 || a.MaxNodeCount != 5 {
+		t.Errorf("Restart() node pool workers autoscaling = %v, want 1-5", a)
+	}
+}
+
+func TestGkeScheduler_InstanceGroupError(t *testing.T) {
+	const igm = "https://www.googleapis.com/compute/v1/projects/demo/zones/us-central1-%s/instanceGroupManagers/gke-dev-workers-grp"
+	clusters := testClusters()
+	clusters[0].NodePools[1].InstanceGroupUrls = []string{fmt.Sprintf(igm, "a"), fmt.Sprintf(igm, "b")}
+	f := newFakeGke("demo", clusters...)
+	f.groupErr = &googleapi.Error{Code: http.StatusForbidden, Message: "required 'compute.instanceGroupManagers.get' permission"}
+	gke := f.start(t)
+	ctx := context.Background()
+
+	list, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	// node pool size falls back to initial node count
+	workers := list[0].Nodes[1]
+	if list[0].Err != nil || workers.NodeCount != clusters[0].NodePools[1].InitialNodeCount || workers.Zones != nil {
+		t.Fatalf("List() cluster error = %v, node pool workers = %+v, want initial node count", list[0].Err, workers)
+	}
+	if err = gke.Stop(ctx, list[0]); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if np := f.clusters[0].NodePools[1]; np.InitialNodeCount != 0 {
+		t.Errorf("Stop() node pool workers = %v, want stopped", np)
+	}
+}
+
+func TestGkeScheduler_StopPolicy(t *testing.T) {
+	clusters := testClusters()
+	clusters[0].ResourceLabels["cs-keep-default"] = "1"
+	clusters[0].ResourceLabels["cs-keep-workers"] = scheduler.KEEP_SKIP
+	f := newFakeGke("demo", clusters...)
+	gke := f.start(t)
+	ctx := context.Background()
+
+	list, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if got := list[0].Nodes[0].Stop; got != (scheduler.StopPolicy{Keep: 1}) {
+		t.Errorf("List() node pool default stop policy = %v, want 1", got)
+	}
+	if err = gke.Stop(ctx, list[0]); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	dev := f.clusters[0]
+	if np := dev.NodePools[0]; np.InitialNodeCount != 1 {
+		t.Errorf("Stop() node pool default = %v, want size 1", np)
+	}
+	if np := dev.NodePools[1]; np.InitialNodeCount != 3 || !np.Autoscaling.Enabled {
+		t.Errorf("Stop() skipped node pool workers = %v, want unchanged", np)
+	}
+	if _, ok := dev.ResourceLabels[scheduler.GetBackupLabel("workers")]; ok {
+		t.Errorf("Stop() labels = %v, want no backup of skipped node pool", dev.ResourceLabels)
+	}
+
+	list, err = gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if err = gke.Restart(ctx, list[0]); err != nil {
+		t.Fatalf("Restart() error = %v", err)
+	}
+	if np := dev.NodePools[0]; np.InitialNodeCount != 2 {
+		t.Errorf("Restart() node pool default = %v, want size 2", np)
+	}
+}
+
+func TestGkeScheduler_NodePoolSchedule(t *testing.T) {
+	clusters := testClusters()
+	// workers node pool runs at night only
+	clusters[0].NodePools[1].Config = &containerpb.NodeConfig{Labels: map[string]string{scheduler.UPTIME_LABEL: "0-6_x_x_x"}}
+	clusters[0].ResourceLabels[scheduler.STATUS_LABEL] = scheduler.STATUS_UP
+	f := newFakeGke("demo", clusters...)
+	gke := f.start(t)
+	ctx := context.Background()
+	dev := f.clusters[0]
+
+	reconcile := func(at time.Time) {
+		t.Helper()
+		list, err := gke.List(ctx)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if _, err = scheduler.Reconcile(ctx, gke, list, at, scheduler.ReconcileOptions{RunOptions: scheduler.RunOptions{Concurrency: 1}}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+
+	// working hours: stop workers node pool only
+	reconcile(time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC))
+	if np := dev.NodePools[1]; np.InitialNodeCount != 0 || np.Autoscaling.Enabled {
+		t.Errorf("Reconcile() node pool workers = %v, want stopped", np)
+	}
+	if np := dev.NodePools[0]; np.InitialNodeCount != 2 {
+		t.Errorf("Reconcile() node pool default = %v, want running", np)
+	}
+	if got := dev.ResourceLabels; got[scheduler.GetStatusLabel("workers")] != scheduler.STATUS_DOWN || got[scheduler.STATUS_LABEL] != scheduler.STATUS_UP {
+		t.Errorf("Reconcile() labels = %v, want only workers node pool down", got)
+	}
+
+	// evening: stop the rest of the cluster
+	reconcile(time.Date(2020, 4, 15, 20, 0, 0, 0, time.UTC))
+	if np := dev.NodePools[0]; np.InitialNodeCount != 0 {
+		t.Errorf("Reconcile() node pool default = %v, want stopped", np)
+	}
+	if got := dev.ResourceLabels[scheduler.STATUS_LABEL]; got != scheduler.STATUS_DOWN {
+		t.Errorf("Reconcile() status label = %q, want %q", got, scheduler.STATUS_DOWN)
+	}
+
+	// night: restart workers node pool from its own backup
+	reconcile(time.Date(2020, 4, 16, 1, 0, 0, 0, time.UTC))
+	if np := dev.NodePools[1]; np.InitialNodeCount != 3 || !np.Autoscaling.Enabled || np.Autoscaling.MaxNodeCount != 5 {
+		t.Errorf("Reconcile() node pool workers = %v, want restored", np)
+	}
+	if np := dev.NodePools[0]; np.InitialNodeCount != 0 {
+		t.Errorf("Reconcile() node pool default = %v, want stopped", np)
+	}
+	if got := dev.ResourceLabels[scheduler.GetStatusLabel("workers")]; got != scheduler.STATUS_UP {
+		t.Errorf("Reconcile() workers status label = %q, want %q", got, scheduler.STATUS_UP)
+	}
+}
+
+func TestGkeScheduler_NodePoolOutlivesCluster(t *testing.T) {
+	clusters := testClusters()
+	// workers node pool runs 4 hours longer than the rest of the cluster
+	clusters[0].NodePools[1].Config = &containerpb.NodeConfig{Labels: map[string]string{scheduler.UPTIME_LABEL: "8-23_x_x_x"}}
+	f := newFakeGke("demo", clusters...)
+	gke := f.start(t)
+	ctx := context.Background()
+	dev := f.clusters[0]
+
+	reconcile := func(at time.Time) {
+		t.Helper()
+		list, err := gke.List(ctx)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if _, err = scheduler.Reconcile(ctx, gke, list, at, scheduler.ReconcileOptions{RunOptions: scheduler.RunOptions{Concurrency: 1}}); err != nil {
+			t.Fatalf("Reconcile() at %s error = %v", at.Format("15:04"), err)
+		}
+	}
+
+	// evening: stop the cluster, keep workers node pool running
+	reconcile(time.Date(2020, 4, 15, 20, 0, 0, 0, time.UTC))
+	if np := dev.NodePools[0]; np.InitialNodeCount != 0 {
+		t.Errorf("Reconcile() node pool default = %v, want stopped", np)
+	}
+	if got := dev.ResourceLabels; got[scheduler.STATUS_LABEL] != scheduler.STATUS_DOWN || got[scheduler.GetStatusLabel("workers")] != scheduler.STATUS_UP {
+		t.Errorf("Reconcile() labels = %v, want cluster down and workers node pool up", got)
+	}
+	// workers node pool is not restarted
+	reconcile(time.Date(2020, 4, 15, 20, 5, 0, 0, time.UTC))
+	if np := dev.NodePools[1]; np.InitialNodeCount != 3 || !np.Autoscaling.Enabled {
+		t.Errorf("Reconcile() node pool workers = %v, want running", np)
+	}
+	// night: stop workers node pool
+	reconcile(time.Date(2020, 4, 15, 23, 30, 0, 0, time.UTC))
+	if np := dev.NodePools[1]; np.InitialNodeCount != 0 || np.Autoscaling.Enabled {
+		t.Errorf("Reconcile() node pool workers = %v, want stopped", np)
+	}
+	// morning: restart both node pools
+	reconcile(time.Date(2020, 4, 16, 8, 0, 0, 0, time.UTC))
+	if np := dev.NodePools[0]; np.InitialNodeCount != 2 {
+		t.Errorf("Reconcile() node pool default = %v, want restored", np)
+	}
+	if np := dev.NodePools[1]; np.InitialNodeCount != 3 || !np.Autoscaling.Enabled {
+		t.Errorf("Reconcile() node pool workers = %v, want restored", np)
+	}
+}
+
+func TestGkeScheduler_Drain(t *testing.T) {
+	clusters := testClusters()
+	clusters[0].Endpoint = "10.0.0.1"
+	clusters[0].ResourceLabels["cs-keep-workers"] = "1"
+	f := newFakeGke("demo", clusters...)
+	gke := f.start(t)
+	ctx := context.Background()
+	client := k8sfake.NewSimpleClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{kube.GKE_NODE_POOL_LABEL: "default"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}, Spec: corev1.PodSpec{NodeName: "node-1"}},
+	)
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		gvr := corev1.SchemeGroupVersion.WithResource("pods")
+		return true, nil, client.Tracker().Delete(gvr, action.GetNamespace(), "web")
+	})
+	var endpoint string
+	WithDrain(time.Second)(gke)
+	withKubeClient(func(_ context.Context, c scheduler.Cluster) (kubernetes.Interface, error) {
+		endpoint = c.Endpoint
+		return client, nil
+	})(gke)
+
+	list, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	plan, err := gke.PlanStop(ctx, list[0])
+	if err != nil {
+		t.Fatalf("PlanStop() error = %v", err)
+	}
+	var drained []string
+	for _, op := range plan.Operations {
+		if op.Type == scheduler.OP_DRAIN {
+			drained = append(drained, op.NodeGroup)
+		}
+	}
+	if !reflect.DeepEqual(drained, []string{"default"}) {
+		t.Errorf("PlanStop() drained node pools = %v, want only node pool scaled to 0", drained)
+	}
+	if err = gke.Stop(ctx, list[0]); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if endpoint != "10.0.0.1" {
+		t.Errorf("Stop() Kubernetes API endpoint = %q, want cluster endpoint", endpoint)
+	}
+	if node, _ := client.CoreV1().Nodes().Get(ctx, "node-1", metav1.GetOptions{}); !node.Spec.Unschedulable {
+		t.Error("Stop() node-1 is not cordoned")
+	}
+	if _, err = client.CoreV1().Pods("default").Get(ctx, "web", metav1.GetOptions{}); err == nil {
+		t.Error("Stop() pod web is not evicted")
+	}
+	if np := f.clusters[0].NodePools[0]; np.InitialNodeCount != 0 {
+		t.Errorf("Stop() node pool default = %v, want size 0", np)
+	}
+}
+
+func TestGkeScheduler_DrainFailure(t *testing.T) {
+	f := newFakeGke("demo", testClusters()...)
+	gke := f.start(t)
+	ctx := context.Background()
+	WithDrain(time.Second)(gke)
+	withKubeClient(func(context.Context, scheduler.Cluster) (kubernetes.Interface, error) {
+		return nil, errors.New("cluster API is not reachable")
+	})(gke)
+
+	list, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	// drain is best effort: node pools are stopped anyway
+	if err = gke.Stop(ctx, list[0]); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if np := f.clusters[0].NodePools[0]; np.InitialNodeCount != 0 {
+		t.Errorf("Stop() node pool default = %v, want size 0", np)
+	}
+}
+
+func TestGkeScheduler_Protected(t *testing.T) {
+	clusters := testClusters()
+	clusters[0].ResourceLabels["cs-keep-workers"] = scheduler.KEEP_SKIP
+	f := newFakeGke("demo", clusters...)
+	gke := f.start(t)
+	ctx := context.Background()
+	nodePool := func(name, pool string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{kube.GKE_NODE_POOL_LABEL: pool}}}
+	}
+	keepAlive := func(name, node string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: map[string]string{kube.KEEP_ALIVE_ANNOTATION: "true"}},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	client := k8sfake.NewSimpleClientset(
+		nodePool("node-1", "default"), nodePool("node-2", "workers"),
+		keepAlive("notebook", "node-1"), keepAlive("training", "node-2"),
+	)
+	withKubeClient(func(context.Context, scheduler.Cluster) (kubernetes.Interface, error) {
+		return client, nil
+	})(gke)
+
+	list, err := gke.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	// skipped node pool keeps running: its workloads are not interrupted
+	got, err := gke.Protected(ctx, list[0])
+	if err != nil {
+		t.Fatalf("Protected() error = %v", err)
+	}
+	if want := []string{"pod default/notebook"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Protected() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+package gke
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	containerpb "google.golang.org/genproto/googleapis/container/v1"
+)
+
+const (
+	default_OPERATION_TIMEOUT = time.Minute * 15
+	default_OPERATION_CHECK   = time.Second * 15
+)
+
+// clusterManager is a subset of GKE ClusterManager client API used by cluster scheduler
+type clusterManager interface {
+	ListClusters(context.Context, *containerpb.ListClustersRequest, ...gax.CallOption) (*containerpb.ListClustersResponse, error)
+	SetLabels(context.Context, *containerpb.SetLabelsRequest, ...gax.CallOption) (*containerpb.Operation, error)
+	SetNodePoolAutoscaling(context.Context, *containerpb.SetNodePoolAutoscalingRequest, ...gax.CallOption) (*containerpb.Operation, error)
+	SetNodePoolSize(context.Context, *containerpb.SetNodePoolSizeRequest, ...gax.CallOption) (*containerpb.Operation, error)
+	GetOperation(context.Context, *containerpb.GetOperationRequest, ...gax.CallOption) (*containerpb.Operation, error)
+	CancelOperation(context.Context, *containerpb.CancelOperationRequest, ...gax.CallOption) error
+}
+
+// OperationTimeoutError is returned when GKE operation is not completed in time; the operation is canceled
+type OperationTimeoutError struct {
+	Operation string
+	Timeout   time.Duration
+}
+
+func (e *OperationTimeoutError) Error() string {
+	return fmt.Sprintf("operation %s is not completed in %v", e.Operation, e.Timeout)
+}
+
+// OperationError is returned when GKE operation is completed with error
+type OperationError struct {
+	Operation string
+	Type      containerpb.Operation_Type
+	Message   string
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %s (%s) failed: %s", e.Operation, e.Type, e.Message)
+}
+
+// operationWaiter polls GKE operation till it is completed
+type operationWaiter struct {
+	cm    clusterManager
+	retry scheduler.RetryPolicy
+	// Poll is interval between operation status checks
+	Poll time.Duration
+	// Timeout is max time to wait for operation to complete
+	Timeout time.Duration
+}
+
+// Wait waits for operation to complete; returns OperationError for failed operation,
+// OperationTimeoutError on timeout (after canceling operation) or context error
+func (w *operationWaiter) Wait(ctx context.Context, project, location string, op *containerpb.Operation) error {
+	if op == nil {
+		return nil
+	}
+	name := fmt.Sprintf("projects/%s/locations/%s/operations/%s", project, location, op.Name)
+	logger := log.WithFields(log.Fields{
+		"operation": op.Name,
+		"type":      op.OperationType,
+	})
+	timeout := time.NewTimer(w.Timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(w.Poll)
+	defer ticker.Stop()
+	for op.Status != containerpb.Operation_DONE {
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "stopped waiting for operation %s", op.Name)
+		case <-timeout.C:
+			logger.Debug("canceling operation on timeout")
+			err := w.retry.Do(ctx, "CancelOperation", func() error {
+				return w.cm.CancelOperation(ctx, &containerpb.CancelOperationRequest{Name: name})
+			})
+			if err != nil {
+				logger.WithError(err).Warn("failed to cancel operation")
+			}
+			return &OperationTimeoutError{Operation: op.Name, Timeout: w.Timeout}
+		case <-ticker.C:
+		}
+		logger.Debug("get operation status")
+		err := w.retry.Do(ctx, "GetOperation", func() (err error) {
+			op, err = w.cm.GetOperation(ctx, &containerpb.GetOperationRequest{Name: name})
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to get operation")
+		}
+	}
+	if msg := operationError(op); msg != "" {
+		return &OperationError{Operation: op.Name, Type: op.OperationType, Message: msg}
+	}
+	logger.Debug("successfully completed operation")
+	return nil
+}
+
+// operationError returns error message of completed operation, if any
+func operationError(op *containerpb.Operation) string {
+	if op.StatusMessage != "" {
+		return op.StatusMessage
+	}
+	var msgs []string
+	for _, c := range append(op.ClusterConditions, op.NodepoolConditions...) {
+		msgs = append(msgs, c.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
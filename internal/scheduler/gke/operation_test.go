@@ -0,0 +1,179 @@
+package gke
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/pkg/errors"
+	containerpb "google.golang.org/genproto/googleapis/container/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClusterManager returns scripted operation statuses
+type fakeClusterManager struct {
+	clusterManager
+	mu       sync.Mutex
+	statuses []*containerpb.Operation
+	errs     []error
+	gets     int
+	canceled []string
+}
+
+func (f *fakeClusterManager) GetOperation(_ context.Context, req *containerpb.GetOperationRequest, _ ...gax.CallOption) (*containerpb.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gets++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return nil, err
+	}
+	if len(f.statuses) == 0 {
+		return &containerpb.Operation{Name: "op", Status: containerpb.Operation_RUNNING}, nil
+	}
+	op := f.statuses[0]
+	f.statuses = f.statuses[1:]
+	return op, nil
+}
+
+func (f *fakeClusterManager) CancelOperation(_ context.Context, req *containerpb.CancelOperationRequest, _ ...gax.CallOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.canceled = append(f.canceled, req.Name)
+	return nil
+}
+
+func TestOperationWaiter_Wait(t *testing.T) {
+	running := &containerpb.Operation{Name: "op", Status: containerpb.Operation_RUNNING}
+	done := &containerpb.Operation{Name: "op", Status: containerpb.Operation_DONE}
+	failed := &containerpb.Operation{
+		Name:          "op",
+		Status:        containerpb.Operation_DONE,
+		OperationType: containerpb.Operation_SET_NODE_POOL_SIZE,
+		StatusMessage: "Insufficient regional quota",
+	}
+	tests := []struct {
+		name     string
+		op       *containerpb.Operation
+		statuses []*containerpb.Operation
+		errs     []error
+		check    func(error) bool
+		gets     int
+		canceled bool
+	}{
+		{
+			name:  "no operation",
+			check: func(err error) bool { return err == nil },
+		},
+		{
+			name:  "completed operation",
+			op:    done,
+			check: func(err error) bool { return err == nil },
+		},
+		{
+			name:     "wait for operation",
+			op:       running,
+			statuses: []*containerpb.Operation{running, running, done},
+			check:    func(err error) bool { return err == nil },
+			gets:     3,
+		},
+		{
+			name:     "failed operation",
+			op:       running,
+			statuses: []*containerpb.Operation{failed},
+			check: func(err error) bool {
+				opErr, ok := err.(*OperationError)
+				return ok && opErr.Message == "Insufficient regional quota"
+			},
+			gets: 1,
+		},
+		{
+			name:     "failed operation conditions",
+			op:       running,
+			statuses: []*containerpb.Operation{{Name: "op", Status: containerpb.Operation_DONE, NodepoolConditions: []*containerpb.StatusCondition{{Message: "GCE quota exceeded"}}}},
+			check: func(err error) bool {
+				opErr, ok := err.(*OperationError)
+				return ok && opErr.Message == "GCE quota exceeded"
+			},
+			gets: 1,
+		},
+		{
+			name:  "retry transient get operation error",
+			op:    running,
+			errs:  []error{status.Error(codes.Unavailable, "unavailable")},
+			check: func(err error) bool { return err == nil },
+			// first status is after error
+			statuses: []*containerpb.Operation{done},
+			gets:     2,
+		},
+		{
+			name: "get operation error",
+			op:   running,
+			errs: []error{status.Error(codes.PermissionDenied, "denied")},
+			check: func(err error) bool {
+				return status.Code(errors.Cause(err)) == codes.PermissionDenied
+			},
+			gets: 1,
+		},
+		{
+			name: "timeout",
+			op:   running,
+			check: func(err error) bool {
+				_, ok := err.(*OperationTimeoutError)
+				return ok
+			},
+			canceled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := &fakeClusterManager{statuses: tt.statuses, errs: tt.errs}
+			w := &operationWaiter{
+				cm:      cm,
+				retry:   scheduler.RetryPolicy{Attempts: 3, Delay: time.Millisecond, Retryable: isRetryable},
+				Poll:    time.Millisecond,
+				Timeout: 100 * time.Millisecond,
+			}
+			err := w.Wait(context.Background(), "demo", "us-central1", tt.op)
+			if !tt.check(err) {
+				t.Errorf("Wait() unexpected error = %v", err)
+			}
+			if tt.gets > 0 && cm.gets != tt.gets {
+				t.Errorf("Wait() GetOperation calls = %d, want %d", cm.gets, tt.gets)
+			}
+			if tt.canceled != (len(cm.canceled) > 0) {
+				t.Errorf("Wait() canceled = %v, want canceled %v", cm.canceled, tt.canceled)
+			}
+			if tt.canceled && cm.canceled[0] != "projects/demo/locations/us-central1/operations/op" {
+				t.Errorf("Wait() canceled = %v", cm.canceled)
+			}
+		})
+	}
+}
+
+func TestOperationWaiter_Canceled(t *testing.T) {
+	cm := &fakeClusterManager{}
+	w := &operationWaiter{cm: cm, Poll: time.Hour, Timeout: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- w.Wait(ctx, "demo", "us-central1", &containerpb.Operation{Name: "op"})
+	}()
+	cancel()
+	select {
+	case err := <-result:
+		if errors.Cause(err) != context.Canceled {
+			t.Errorf("Wait() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait() does not return on context cancellation")
+	}
+	if len(cm.canceled) != 0 {
+		t.Errorf("Wait() canceled operation on context cancellation")
+	}
+}
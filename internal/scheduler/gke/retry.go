@@ -0,0 +1,33 @@
+package gke
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// isRetryable classifies transient GKE (gRPC) and Compute Engine or GCS (HTTP) API errors
+func isRetryable(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return gerr.Code == http.StatusTooManyRequests || gerr.Code >= http.StatusInternalServerError
+	}
+	s, ok := status.FromError(errors.Cause(err))
+	if !ok {
+		return false
+	}
+	switch s.Code() {
+	case codes.Unavailable, codes.ResourceExhausted, codes.Aborted, codes.DeadlineExceeded:
+		return true
+	case codes.FailedPrecondition:
+		// GKE runs one operation per cluster at a time: retry after concurrent operation completes
+		msg := strings.ToLower(s.Message())
+		return strings.Contains(msg, "incompatible operation") ||
+			strings.Contains(msg, "operation") && (strings.Contains(msg, "in progress") || strings.Contains(msg, "is currently"))
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package gke
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_isRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unavailable", status.Error(codes.Unavailable, "service unavailable"), true},
+		{"quota", status.Error(codes.ResourceExhausted, "quota exceeded"), true},
+		{"wrapped", pkgerrors.Wrap(status.Error(codes.Unavailable, "service unavailable"), "failed"), true},
+		{
+			"concurrent operation",
+			status.Error(codes.FailedPrecondition, "Cluster is running incompatible operation operation-1587631247-1234."),
+			true,
+		},
+		{
+			"operation in progress",
+			status.Error(codes.FailedPrecondition, "Operation operation-1587631247-1234 is currently upgrading cluster dev."),
+			true,
+		},
+		{"precondition", status.Error(codes.FailedPrecondition, "Node pool autoscaling is disabled."), false},
+		{"invalid argument", status.Error(codes.InvalidArgument, "invalid node count"), false},
+		{"not found", status.Error(codes.NotFound, "cluster not found"), false},
+		{"not gRPC", errors.New("failed"), false},
+		{"HTTP rate limit", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"HTTP server error", pkgerrors.Wrap(&googleapi.Error{Code: http.StatusServiceUnavailable}, "failed"), true},
+		{"HTTP not found", &googleapi.Error{Code: http.StatusNotFound}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package gke
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+)
+
+// StorageClient reads and writes backup objects in GCS bucket
+type StorageClient struct {
+	objects *storage.ObjectsService
+	bucket  string
+	retry   scheduler.RetryPolicy
+}
+
+// NewStorageClient returns GCS bucket client, using default credentials unless client options are given
+func NewStorageClient(ctx context.Context, bucket string, opts ...option.ClientOption) (*StorageClient, error) {
+	opts = append([]option.ClientOption{option.WithScopes(storage.DevstorageReadWriteScope)}, opts...)
+	svc, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create GCS client")
+	}
+	return &StorageClient{objects: storage.NewObjectsService(svc), bucket: bucket, retry: scheduler.NewRetryPolicy(isRetryable)}, nil
+}
+
+// Put creates or overwrites object
+func (s *StorageClient) Put(ctx context.Context, key string, data []byte) error {
+	return s.retry.Do(ctx, "InsertObject", func() error {
+		_, err := s.objects.Insert(s.bucket, &storage.Object{Name: key, ContentType: "application/json"}).
+			Media(bytes.NewReader(data)).Context(ctx).Do()
+		return err
+	})
+}
+
+// Get returns object data; scheduler.ErrObjectNotFound if object does not exist
+func (s *StorageClient) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := s.retry.Do(ctx, "GetObject", func() error {
+		resp, err := s.objects.Get(s.bucket, key).Context(ctx).Download()
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, err = ioutil.ReadAll(resp.Body)
+		return err
+	})
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+		return nil, scheduler.ErrObjectNotFound
+	}
+	return data, err
+}
+
+// List returns keys of objects with prefix
+func (s *StorageClient) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	var token string
+	for {
+		var objects *storage.Objects
+		err := s.retry.Do(ctx, "ListObjects", func() (err error) {
+			objects, err = s.objects.List(s.bucket).Prefix(prefix).PageToken(token).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objects.Items {
+			keys = append(keys, o.Name)
+		}
+		if token = objects.NextPageToken; token == "" {
+			return keys, nil
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package gke
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"google.golang.org/api/option"
+)
+
+// fakeGcs is a minimal in-memory stand-in for the GCS JSON API
+type fakeGcs struct {
+	sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+func (f *fakeGcs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/"+f.bucket+"/o":
+		// multipart upload: object metadata followed by media
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		var object struct {
+			Name string `json:"name"`
+		}
+		part, err := mr.NextPart()
+		if err == nil {
+			err = json.NewDecoder(part).Decode(&object)
+		}
+		if err == nil {
+			part, err = mr.NextPart()
+		}
+		var data []byte
+		if err == nil {
+			data, err = ioutil.ReadAll(part)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[object.Name] = data
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{"bucket": f.bucket, "name": object.Name})
+	case r.Method == http.MethodGet && r.URL.Path == "/storage/v1/b/"+f.bucket+"/o":
+		type object struct {
+			Name string `json:"name"`
+		}
+		var items []object
+		for name := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				items = append(items, object{Name: name})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/storage/v1/b/"+f.bucket+"/o/"):
+		data, ok := f.objects[strings.TrimPrefix(r.URL.Path, "/storage/v1/b/"+f.bucket+"/o/")]
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":404,"message":"No such object"}}`))
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestStorageClient(t *testing.T) {
+	f := &fakeGcs{bucket: "backups", objects: map[string][]byte{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+	client, err := NewStorageClient(ctx, f.bucket, option.WithEndpoint(srv.URL+"/storage/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.retry = scheduler.RetryPolicy{Attempts: 1, Retryable: isRetryable}
+	store := scheduler.ObjectStore{Client: client, Prefix: "cluster-scheduler"}
+	cluster := scheduler.Cluster{
+		Project:  "demo",
+		Location: "us-central1",
+		Name:     "dev",
+		Nodes:    []scheduler.NodeGroup{{Name: "workers", NodeCount: 3, MinNodeCount: 1, MaxNodeCount: 5, Autoscaling: true}},
+	}
+
+	if _, err = scheduler.LoadBackup(ctx, store, cluster, ""); err != scheduler.ErrBackupNotFound {
+		t.Fatalf("LoadBackup() error = %v, want %v", err, scheduler.ErrBackupNotFound)
+	}
+	first := scheduler.NewClusterBackup(cluster, time.Date(2020, 4, 15, 19, 0, 0, 0, time.UTC))
+	cluster.Nodes[0].NodeCount = 5
+	latest := scheduler.NewClusterBackup(cluster, time.Date(2020, 4, 16, 19, 0, 0, 0, time.UTC))
+	for _, b := range []*scheduler.ClusterBackup{latest, first} {
+		if err = store.Save(ctx, b); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+	if _, ok := f.objects["cluster-scheduler/"+cluster.ID()+"/20200415-190000.json"]; !ok {
+		t.Errorf("Save() objects = %v, want snapshot 20200415-190000 of cluster %s", f.objects, cluster.ID())
+	}
+	backups, err := store.List(ctx, cluster)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(backups) != 2 || backups[0].Snapshot() != first.Snapshot() || backups[1].Snapshot() != latest.Snapshot() {
+		t.Errorf("List() = %v, want snapshots %s, %s", backups, first.Snapshot(), latest.Snapshot())
+	}
+	for snapshot, want := range map[string]int32{"": 5, first.Snapshot(): 3} {
+		backup, err := scheduler.LoadBackup(ctx, store, cluster, snapshot)
+		if err != nil {
+			t.Fatalf("LoadBackup(%q) error = %v", snapshot, err)
+		}
+		if got, err := backup.NodeGroup("workers"); err != nil || !got.Autoscaling || got.NodeCount != want {
+			t.Errorf("LoadBackup(%q) node group = %v (error %v), want %d nodes", snapshot, got, err, want)
+		}
+	}
+}
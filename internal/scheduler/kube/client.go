@@ -0,0 +1,35 @@
+package kube
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// NewClient returns Kubernetes client for cluster API server endpoint (host or URL), trusting cluster CA
+// certificate (PEM) and authenticating with bearer tokens from token source
+func NewClient(endpoint string, caCert []byte, ts oauth2.TokenSource) (kubernetes.Interface, error) {
+	if endpoint == "" {
+		return nil, errors.New("cluster has no Kubernetes API endpoint")
+	}
+	host := endpoint
+	if !strings.HasPrefix(host, "https://") {
+		host = "https://" + host
+	}
+	config := &rest.Config{
+		Host:            host,
+		TLSClientConfig: rest.TLSClientConfig{CAData: caCert},
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			return &oauth2.Transport{Source: oauth2.ReuseTokenSource(nil, ts), Base: rt}
+		},
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Kubernetes client")
+	}
+	return client, nil
+}
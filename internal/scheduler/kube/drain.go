@@ -0,0 +1,155 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// node labels of GKE node pool and EKS managed node group
+	GKE_NODE_POOL_LABEL  = "cloud.google.com/gke-nodepool"
+	EKS_NODE_GROUP_LABEL = "eks.amazonaws.com/nodegroup"
+	// static (mirror) pod annotation: mirror pods cannot be evicted
+	mirror_POD_ANNOTATION = "kubernetes.io/config.mirror"
+	// default interval between eviction retries and pod termination checks
+	default_DRAIN_POLL = 5 * time.Second
+)
+
+// Drainer cordons nodes and evicts their pods, respecting PodDisruptionBudgets
+type Drainer struct {
+	Client kubernetes.Interface
+	// Timeout is max time to wait for pods eviction
+	Timeout time.Duration
+	// Poll is interval between eviction retries (blocked by PodDisruptionBudget) and pod termination checks;
+	// 5 seconds or 1/10 of timeout by default
+	Poll time.Duration
+}
+
+// Drain cordons nodes matching label selector and evicts their pods, except DaemonSet and mirror pods;
+// returns error if some pods are still running after timeout
+func (d *Drainer) Drain(ctx context.Context, selector string) error {
+	nodes, err := d.Client.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return errors.Wrap(err, "failed to list nodes")
+	}
+	var pods []corev1.Pod
+	for _, node := range nodes.Items {
+		if err = d.cordon(ctx, node); err != nil {
+			return err
+		}
+		nodePods, err := d.Client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{FieldSelector: "spec.nodeName=" + node.Name})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list pods of node %s", node.Name)
+		}
+		for _, pod := range nodePods.Items {
+			if pod.Spec.NodeName == node.Name && evictable(pod) {
+				pods = append(pods, pod)
+			}
+		}
+	}
+	log.WithFields(log.Fields{"selector": selector, "nodes": len(nodes.Items), "pods": len(pods)}).Debug("draining nodes")
+	return d.evict(ctx, pods)
+}
+
+// cordon marks node unschedulable
+func (d *Drainer) cordon(ctx context.Context, node corev1.Node) error {
+	if node.Spec.Unschedulable {
+		return nil
+	}
+	_, err := d.Client.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType,
+		[]byte(`{"spec":{"unschedulable":true}}`), metav1.PatchOptions{})
+	return errors.Wrapf(err, "failed to cordon node %s", node.Name)
+}
+
+// evictable reports whether pod should be evicted: running pod not managed by DaemonSet or kubelet (mirror pod)
+func evictable(pod corev1.Pod) bool {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return false
+	}
+	if _, ok := pod.Annotations[mirror_POD_ANNOTATION]; ok {
+		return false
+	}
+	if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "DaemonSet" {
+		return false
+	}
+	return true
+}
+
+// evict requests pods eviction, retrying evictions blocked by PodDisruptionBudget, and waits for pods to terminate
+func (d *Drainer) evict(ctx context.Context, pods []corev1.Pod) error {
+	poll := d.Poll
+	if poll <= 0 {
+		// check several times within short timeout
+		poll = default_DRAIN_POLL
+		if p := d.Timeout / 10; p > 0 && p < poll {
+			poll = p
+		}
+	}
+	timeout := time.NewTimer(d.Timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	evicted := make(map[types.UID]bool, len(pods))
+	for {
+		var running []string
+		for _, pod := range pods {
+			done, err := d.evictPod(ctx, pod, evicted)
+			if err != nil {
+				return err
+			}
+			if !done {
+				running = append(running, pod.Namespace+"/"+pod.Name)
+			}
+		}
+		if len(running) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return errors.Errorf("timeout evicting %d pod(s): %s", len(running), strings.Join(running, ", "))
+		case <-ticker.C:
+		}
+	}
+}
+
+// evictPod requests pod eviction once and reports whether pod is gone
+func (d *Drainer) evictPod(ctx context.Context, pod corev1.Pod, evicted map[types.UID]bool) (bool, error) {
+	if evicted[pod.UID] {
+		current, err := d.Client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to get pod %s/%s", pod.Namespace, pod.Name)
+		}
+		// pod recreated with the same name (StatefulSet) is not our concern
+		return current.UID != pod.UID, nil
+	}
+	err := d.Client.PolicyV1beta1().Evictions(pod.Namespace).Evict(ctx, &policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	})
+	switch {
+	case apierrors.IsNotFound(err):
+		return true, nil
+	case apierrors.IsTooManyRequests(err):
+		// eviction would violate PodDisruptionBudget: retry later
+		log.WithField("pod", pod.Namespace+"/"+pod.Name).Debug("pod eviction blocked by disruption budget")
+		return false, nil
+	case err != nil:
+		return false, errors.Wrapf(err, "failed to evict pod %s/%s", pod.Namespace, pod.Name)
+	}
+	evicted[pod.UID] = true
+	return false, nil
+}
@@ -0,0 +1,104 @@
+package kube
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func node(name, pool string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{GKE_NODE_POOL_LABEL: pool}}}
+}
+
+func pod(name, node string, mutate ...func(*corev1.Pod)) *corev1.Pod {
+	p := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	for _, fn := range mutate {
+		fn(p)
+	}
+	return p
+}
+
+// fakeClient returns fake clientset deleting evicted pods; eviction of pods in blocked is rejected
+// as PodDisruptionBudget violation the given number of times
+func fakeClient(blocked map[string]int, objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		name := action.(k8stesting.CreateAction).GetObject().(metav1.Object).GetName()
+		if blocked[name] > 0 {
+			blocked[name]--
+			return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 1)
+		}
+		gvr := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+		return true, nil, client.Tracker().Delete(gvr, action.GetNamespace(), name)
+	})
+	return client
+}
+
+func TestDrainer_Drain(t *testing.T) {
+	client := fakeClient(map[string]int{"db": 2},
+		node("n1", "pool-a"), node("n2", "pool-a"), node("n3", "pool-b"),
+		pod("web", "n1"),
+		pod("fluentd", "n1", func(p *corev1.Pod) {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "fluentd", Controller: boolPtr(true)}}
+		}),
+		pod("kube-proxy", "n2", func(p *corev1.Pod) { p.Annotations = map[string]string{mirror_POD_ANNOTATION: "hash"} }),
+		pod("db", "n2"),
+		pod("done", "n2", func(p *corev1.Pod) { p.Status.Phase = corev1.PodSucceeded }),
+		pod("api", "n3"),
+	)
+	d := &Drainer{Client: client, Timeout: 5 * time.Second, Poll: time.Millisecond}
+	ctx := context.Background()
+	if err := d.Drain(ctx, GKE_NODE_POOL_LABEL+"=pool-a"); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+
+	nodes, _ := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	for _, n := range nodes.Items {
+		if want := n.Labels[GKE_NODE_POOL_LABEL] == "pool-a"; n.Spec.Unschedulable != want {
+			t.Errorf("Drain() node %s unschedulable = %v, want %v", n.Name, n.Spec.Unschedulable, want)
+		}
+	}
+	pods, _ := client.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	var names []string
+	for _, p := range pods.Items {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	if got, want := strings.Join(names, ","), "api,done,fluentd,kube-proxy"; got != want {
+		t.Errorf("Drain() remaining pods = %s, want %s", got, want)
+	}
+}
+
+func TestDrainer_DrainTimeout(t *testing.T) {
+	client := fakeClient(map[string]int{"db": 1000}, node("n1", "pool-a"), pod("db", "n1"), pod("web", "n1"))
+	d := &Drainer{Client: client, Timeout: 50 * time.Millisecond, Poll: time.Millisecond}
+	err := d.Drain(context.Background(), GKE_NODE_POOL_LABEL+"=pool-a")
+	if err == nil || !strings.Contains(err.Error(), "default/db") {
+		t.Fatalf("Drain() error = %v, want timeout evicting default/db", err)
+	}
+	if _, err = client.CoreV1().Pods("default").Get(context.Background(), "web", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Drain() pod web error = %v, want evicted", err)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// KEEP_ALIVE_ANNOTATION marks pod that must not be interrupted by scheduled stop, when set to "true"
+	KEEP_ALIVE_ANNOTATION = "cluster-scheduler/keep-alive"
+)
+
+// NodeGroupSelector returns label selector of nodes of node groups, by node group label
+func NodeGroupSelector(label string, groups []scheduler.NodeGroup) string {
+	names := make([]string, 0, len(groups))
+	for _, ng := range groups {
+		names = append(names, ng.Name)
+	}
+	return label + " in (" + strings.Join(names, ",") + ")"
+}
+
+// ProtectedWorkloads returns workloads running on nodes matching label selector that must not be interrupted:
+// running Jobs ('job <namespace>/<name>') and pods annotated 'cluster-scheduler/keep-alive=true' ('pod <namespace>/<name>')
+func ProtectedWorkloads(ctx context.Context, client kubernetes.Interface, selector string) ([]string, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+	if len(nodes.Items) == 0 {
+		return nil, nil
+	}
+	names := make(map[string]bool, len(nodes.Items))
+	for _, node := range nodes.Items {
+		names[node.Name] = true
+	}
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+	found := map[string]bool{}
+	for _, pod := range pods.Items {
+		if !names[pod.Spec.NodeName] || (pod.Status.Phase != corev1.PodRunning && pod.Status.Phase != corev1.PodPending) {
+			continue
+		}
+		if pod.Annotations[KEEP_ALIVE_ANNOTATION] == "true" {
+			found["pod "+pod.Namespace+"/"+pod.Name] = true
+		}
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.Kind == "Job" {
+			found["job "+pod.Namespace+"/"+owner.Name] = true
+		}
+	}
+	workloads := make([]string, 0, len(found))
+	for w := range found {
+		workloads = append(workloads, w)
+	}
+	sort.Strings(workloads)
+	return workloads, nil
+}
@@ -0,0 +1,52 @@
+package kube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestProtectedWorkloads(t *testing.T) {
+	job := func(name string) func(*corev1.Pod) {
+		return func(p *corev1.Pod) {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: "Job", Name: name, Controller: boolPtr(true)}}
+		}
+	}
+	keepAlive := func(p *corev1.Pod) { p.Annotations = map[string]string{KEEP_ALIVE_ANNOTATION: "true"} }
+	client := fake.NewSimpleClientset(
+		node("n1", "pool-a"), node("n2", "pool-a"), node("n3", "pool-b"),
+		pod("web", "n1"),
+		pod("report-1", "n1", job("report")),
+		pod("report-2", "n2", job("report")),
+		pod("backup-1", "n1", job("backup"), func(p *corev1.Pod) { p.Status.Phase = corev1.PodSucceeded }),
+		pod("notebook", "n2", keepAlive),
+		pod("disabled", "n2", func(p *corev1.Pod) { p.Annotations = map[string]string{KEEP_ALIVE_ANNOTATION: "false"} }),
+		pod("etl-1", "n3", job("etl")),
+	)
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{selector: GKE_NODE_POOL_LABEL + "=pool-a", want: []string{"job default/report", "pod default/notebook"}},
+		{selector: GKE_NODE_POOL_LABEL + " in (pool-a,pool-b)", want: []string{"job default/etl", "job default/report", "pod default/notebook"}},
+		{selector: GKE_NODE_POOL_LABEL + "=pool-c", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			got, err := ProtectedWorkloads(context.Background(), client, tt.selector)
+			if err != nil {
+				t.Fatalf("ProtectedWorkloads() error = %v", err)
+			}
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProtectedWorkloads() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// status_FORMAT is status label of node group with own schedule: 'cs-status-<node group>'
+	status_FORMAT = "cs-status-%s"
+)
+
+// GetStatusLabel returns name of status label of node group with own schedule
+func GetStatusLabel(name string) string {
+	return fmt.Sprintf(status_FORMAT, name)
+}
+
+// hasUptime reports whether labels define uptime schedule
+func hasUptime(labels map[string]string) bool {
+	for key := range labels {
+		if key == UPTIME_LABEL || strings.HasPrefix(key, UPTIME_LABEL+"-") || key == START_CRON_LABEL || key == STOP_CRON_LABEL {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNodeGroupSchedule parses node group own schedule from node group labels (GKE) or tags (EKS),
+// using the same labels as cluster schedule; time zone and calendar default to cluster ones.
+// Returns nil if node group has no uptime labels and follows cluster schedule.
+func ParseNodeGroupSchedule(labels, clusterLabels map[string]string, calendars Calendars) (*Schedule, error) {
+	if !hasUptime(labels) {
+		return nil, nil
+	}
+	merged := make(map[string]string, len(labels)+2)
+	for _, key := range []string{TIMEZONE_LABEL, CALENDAR_LABEL} {
+		if value, ok := clusterLabels[key]; ok {
+			merged[key] = value
+		}
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return ParseSchedule(merged, calendars)
+}
+
+// ParseNodeGroups reads stop policies from cluster labels and own schedules from node group labels (by node group name)
+// of cluster node groups; status of node group with own schedule is read from 'cs-status-<node group>' cluster label
+func (c *Cluster) ParseNodeGroups(labels map[string]map[string]string, calendars Calendars) error {
+	if err := c.ParseStopPolicies(); err != nil {
+		return err
+	}
+	for i := range c.Nodes {
+		ng := &c.Nodes[i]
+		schedule, err := ParseNodeGroupSchedule(labels[ng.Name], c.Labels, calendars)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse node group %s schedule", ng.Name)
+		}
+		ng.Schedule = schedule
+		if schedule != nil {
+			ng.Status = c.Labels[GetStatusLabel(ng.Name)]
+		}
+	}
+	return nil
+}
+
+// NodeGroupStatus returns status of node group: own status of node group with own schedule, once it was
+// stopped or restarted on its own, and cluster status otherwise
+func (c *Cluster) NodeGroupStatus(ng NodeGroup) string {
+	if ng.Schedule != nil && ng.Status != "" {
+		return ng.Status
+	}
+	return c.Status
+}
+
+// Transition returns cluster with node groups to bring to status: node groups in another status;
+// false if cluster (without node groups) or all its node groups are already in status
+func (c Cluster) Transition(status string) (Cluster, bool) {
+	return c.filter(func(ng NodeGroup) bool { return c.NodeGroupStatus(ng) != status }, c.Status != status)
+}
+
+// StatusLabels returns status labels to set on cluster node groups status change: 'cs-status-<node group>'
+// for node groups with own schedule and 'cs-status' for the rest (or cluster without node groups).
+// When 'cs-status' changes, node groups with own schedule left out of transition and without own status
+// label get one with their current status: otherwise, their status would change with the cluster one.
+func (c Cluster) StatusLabels(status string) map[string]string {
+	labels := map[string]string{}
+	if len(c.Nodes) == 0 {
+		labels[STATUS_LABEL] = status
+	}
+	for _, ng := range c.Nodes {
+		if ng.Schedule != nil {
+			labels[GetStatusLabel(ng.Name)] = status
+		} else {
+			labels[STATUS_LABEL] = status
+		}
+	}
+	if _, ok := labels[STATUS_LABEL]; ok {
+		for k, v := range c.pinned {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// filter returns cluster copy with node groups matching fn; cluster without node groups matches if empty is true
+func (c Cluster) filter(fn func(NodeGroup) bool, empty bool) (Cluster, bool) {
+	if len(c.Nodes) == 0 {
+		return c, empty
+	}
+	result := c
+	result.Nodes = nil
+	result.pinned = make(map[string]string, len(c.pinned))
+	for k, v := range c.pinned {
+		result.pinned[k] = v
+	}
+	// cluster (node group) without status label is considered running
+	current := c.Status
+	if current == "" {
+		current = STATUS_UP
+	}
+	for _, ng := range c.Nodes {
+		switch {
+		case fn(ng):
+			result.Nodes = append(result.Nodes, ng)
+		case ng.Schedule != nil && ng.Status == "":
+			result.pinned[GetStatusLabel(ng.Name)] = current
+		}
+	}
+	return result, len(result.Nodes) > 0
+}
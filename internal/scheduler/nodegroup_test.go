@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNodeGroupSchedule(t *testing.T) {
+	clusterLabels := map[string]string{UPTIME_LABEL: "8-19_1-6_x_x", TIMEZONE_LABEL: "Europe/Berlin"}
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "follows cluster schedule",
+			labels: map[string]string{"team": "data"},
+		},
+		{
+			name:   "uptime label with cluster time zone",
+			labels: map[string]string{UPTIME_LABEL: "0-6_x_x_x"},
+			want:   "0-6_x_x_x tz:Europe/Berlin",
+		},
+		{
+			name:   "numbered uptime label with own time zone",
+			labels: map[string]string{UPTIME_LABEL + "-1": "0-6_x_x_x", TIMEZONE_LABEL: "UTC"},
+			want:   "0-6_x_x_x",
+		},
+		{
+			name:    "cron label without pair",
+			labels:  map[string]string{START_CRON_LABEL: "0 8 * * 1-5"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNodeGroupSchedule(tt.labels, clusterLabels, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNodeGroupSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != (tt.want == "") || (got != nil && got.String() != tt.want) {
+				t.Errorf("ParseNodeGroupSchedule() = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCluster_ParseNodeGroups(t *testing.T) {
+	cluster := Cluster{
+		Status: STATUS_DOWN,
+		Labels: map[string]string{
+			UPTIME_LABEL:             "8-19_1-6_x_x",
+			GetStatusLabel("batch"):  STATUS_UP,
+			GetStatusLabel("system"): STATUS_UP,
+			GetKeepLabel("system"):   "1",
+		},
+		Nodes: []NodeGroup{{Name: "batch"}, {Name: "system"}},
+	}
+	err := cluster.ParseNodeGroups(map[string]map[string]string{"batch": {UPTIME_LABEL: "0-6_x_x_x"}}, nil)
+	if err != nil {
+		t.Fatalf("ParseNodeGroups() error = %v", err)
+	}
+	batch, system := cluster.Nodes[0], cluster.Nodes[1]
+	if batch.Schedule == nil || batch.Status != STATUS_UP || cluster.NodeGroupStatus(batch) != STATUS_UP {
+		t.Errorf("ParseNodeGroups() batch = %+v, want own schedule and status", batch)
+	}
+	// stale status label of node group without own schedule is ignored
+	if system.Schedule != nil || system.Status != "" || system.Stop.Keep != 1 || cluster.NodeGroupStatus(system) != STATUS_DOWN {
+		t.Errorf("ParseNodeGroups() system = %+v, want cluster schedule and status", system)
+	}
+
+	err = cluster.ParseNodeGroups(map[string]map[string]string{"batch": {UPTIME_LABEL: "invalid"}}, nil)
+	if err == nil {
+		t.Error("ParseNodeGroups() with invalid node group uptime, want error")
+	}
+}
+
+func TestCluster_Transition(t *testing.T) {
+	night := &Schedule{Windows: []Window{&UptimeRange{Minutes: Range{0, 6 * 60}, Weekdays: Range{0, 7}, Days: Range{1, 32}, Months: Range{1, 13}}}}
+	cluster := Cluster{
+		Status: STATUS_UP,
+		Nodes: []NodeGroup{
+			{Name: "default"},
+			{Name: "batch", Schedule: night, Status: STATUS_DOWN},
+		},
+	}
+	tests := []struct {
+		status     string
+		wantNodes  []string
+		wantLabels map[string]string
+	}{
+		{
+			status:     STATUS_DOWN,
+			wantNodes:  []string{"default"},
+			wantLabels: map[string]string{STATUS_LABEL: STATUS_DOWN},
+		},
+		{
+			status:     STATUS_UP,
+			wantNodes:  []string{"batch"},
+			wantLabels: map[string]string{GetStatusLabel("batch"): STATUS_UP},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			got, ok := cluster.Transition(tt.status)
+			if !ok || !equal(nodeGroupNames(got), tt.wantNodes) {
+				t.Fatalf("Transition() = %v, %v, want %v", nodeGroupNames(got), ok, tt.wantNodes)
+			}
+			if labels := got.StatusLabels(tt.status); !reflect.DeepEqual(labels, tt.wantLabels) {
+				t.Errorf("StatusLabels() = %v, want %v", labels, tt.wantLabels)
+			}
+		})
+	}
+
+	stopped := Cluster{Status: STATUS_DOWN}
+	if _, ok := stopped.Transition(STATUS_DOWN); ok {
+		t.Error("Transition() of stopped cluster without node groups, want nothing to do")
+	}
+	if got := stopped.StatusLabels(STATUS_UP); !reflect.DeepEqual(got, map[string]string{STATUS_LABEL: STATUS_UP}) {
+		t.Errorf("StatusLabels() of cluster without node groups = %v", got)
+	}
+	// desired status of node group with own schedule
+	if got := cluster.DesiredNodeGroupStatus(cluster.Nodes[1], time.Date(2020, 4, 15, 1, 0, 0, 0, time.UTC)); got != STATUS_UP {
+		t.Errorf("DesiredNodeGroupStatus() = %s, want %s", got, STATUS_UP)
+	}
+}
+
+func TestCluster_StatusLabelsPinned(t *testing.T) {
+	schedule := func(uptime string) *Schedule {
+		s, err := ParseSchedule(map[string]string{UPTIME_LABEL: uptime}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	tests := []struct {
+		name       string
+		cluster    Cluster
+		at         time.Time
+		stop       bool
+		wantLabels map[string]string
+	}{
+		{
+			name: "node group outlives cluster uptime",
+			cluster: Cluster{
+				Schedule: *schedule("8-19_x_x_x"),
+				Nodes:    []NodeGroup{{Name: "default"}, {Name: "workers", Schedule: schedule("8-23_x_x_x")}},
+			},
+			at:         time.Date(2020, 4, 15, 20, 0, 0, 0, time.UTC),
+			stop:       true,
+			wantLabels: map[string]string{STATUS_LABEL: STATUS_DOWN, GetStatusLabel("workers"): STATUS_UP},
+		},
+		{
+			name: "node group starts after cluster",
+			cluster: Cluster{
+				Status:   STATUS_DOWN,
+				Schedule: *schedule("8-19_x_x_x"),
+				Nodes:    []NodeGroup{{Name: "default"}, {Name: "workers", Schedule: schedule("10-19_x_x_x")}},
+			},
+			at:         time.Date(2020, 4, 15, 8, 0, 0, 0, time.UTC),
+			wantLabels: map[string]string{STATUS_LABEL: STATUS_UP, GetStatusLabel("workers"): STATUS_DOWN},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduled, ok := tt.cluster.ScheduledRestart(tt.at)
+			status := STATUS_UP
+			if tt.stop {
+				scheduled, ok = tt.cluster.ScheduledStop(tt.at)
+				status = STATUS_DOWN
+			}
+			if !ok || !equal(nodeGroupNames(scheduled), []string{"default"}) {
+				t.Fatalf("scheduled node groups = %v, %v, want [default]", nodeGroupNames(scheduled), ok)
+			}
+			// runner filters scheduled cluster again
+			scheduled, _ = scheduled.Transition(status)
+			if got := scheduled.StatusLabels(status); !reflect.DeepEqual(got, tt.wantLabels) {
+				t.Errorf("StatusLabels() = %v, want %v", got, tt.wantLabels)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// planned operation types
+	OP_SET_LABELS      = "set-labels"
+	OP_SET_AUTOSCALING = "set-autoscaling"
+	OP_SET_SIZE        = "set-size"
+	OP_SET_ZONE_SIZE   = "set-zone-size"
+	OP_SET_SCALING     = "set-scaling"
+	OP_SAVE_BACKUP     = "save-backup"
+	OP_DRAIN           = "drain"
+)
+
+// Operation is a single planned mutating cloud API call
+type Operation struct {
+	Type string
+	// node group name; empty for cluster operations
+	NodeGroup string
+	// zone of node group, for zone operations
+	Zone string
+	// labels (tags) to create or update
+	Labels map[string]string
+	// node group autoscaling and size
+	Autoscaling  bool
+	NodeCount    int32
+	MinNodeCount int32
+	MaxNodeCount int32
+	// backup to save in backup store
+	Backup *ClusterBackup
+}
+
+func (op Operation) String() string {
+	var s string
+	switch op.Type {
+	case OP_SET_LABELS:
+		keys := make([]string, 0, len(op.Labels))
+		for k := range op.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		labels := make([]string, 0, len(keys))
+		for _, k := range keys {
+			labels = append(labels, k+"="+op.Labels[k])
+		}
+		s = "set labels: " + strings.Join(labels, ", ")
+	case OP_SET_AUTOSCALING:
+		if op.Autoscaling {
+			s = fmt.Sprintf("enable autoscaling: min %d, max %d", op.MinNodeCount, op.MaxNodeCount)
+		} else {
+			s = "disable autoscaling"
+		}
+	case OP_SET_SIZE:
+		s = fmt.Sprintf("set size: %d", op.NodeCount)
+	case OP_SET_ZONE_SIZE:
+		s = fmt.Sprintf("set size in zone %s: %d", op.Zone, op.NodeCount)
+	case OP_SET_SCALING:
+		s = fmt.Sprintf("set scaling: min %d, desired %d, max %d", op.MinNodeCount, op.NodeCount, op.MaxNodeCount)
+	case OP_SAVE_BACKUP:
+		groups := make([]string, 0, len(op.Backup.NodeGroups))
+		for name, ng := range op.Backup.NodeGroups {
+			groups = append(groups, fmt.Sprintf("%s=%d[%d-%d]", name, ng.NodeCount, ng.MinNodeCount, ng.MaxNodeCount))
+		}
+		sort.Strings(groups)
+		s = "save backup: " + strings.Join(groups, ", ")
+	case OP_DRAIN:
+		s = "cordon nodes and evict pods"
+	default:
+		s = op.Type
+	}
+	if op.NodeGroup != "" {
+		s = fmt.Sprintf("node pool %s: %s", op.NodeGroup, s)
+	}
+	return s
+}
+
+// Plan is an ordered list of operations required to bring cluster to target status
+type Plan struct {
+	Cluster    Cluster
+	Status     string
+	Operations []Operation
+}
+
+// Add appends operation to plan
+func (p *Plan) Add(op Operation) {
+	p.Operations = append(p.Operations, op)
+}
+
+// Write writes human-readable plan
+func (p *Plan) Write(w io.Writer) error {
+	// write plan at once: plans of multiple clusters can be written concurrently
+	var buf bytes.Buffer
+	p.write(&buf)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (p *Plan) write(w io.Writer) {
+	name := p.Cluster.Name
+	if p.Cluster.Project != "" {
+		name = p.Cluster.Project + "/" + name
+	}
+	action := "stop"
+	if p.Status == STATUS_UP {
+		action = "restart"
+	}
+	if len(p.Operations) == 0 {
+		fmt.Fprintf(w, "cluster %s (%s): nothing to %s\n", name, p.Cluster.Location, action)
+		return
+	}
+	fmt.Fprintf(w, "cluster %s (%s): %s\n", name, p.Cluster.Location, action)
+	for _, op := range p.Operations {
+		fmt.Fprintf(w, "  %s\n", op)
+	}
+}
+
+// DryRunner writes planned operations instead of executing them
+type DryRunner struct {
+	Runner
+	Out io.Writer
+	mu  sync.Mutex
+}
+
+func (d *DryRunner) write(plan *Plan) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return plan.Write(d.Out)
+}
+
+func (d *DryRunner) Stop(ctx context.Context, cluster Cluster) error {
+	plan, err := d.Runner.PlanStop(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return d.write(plan)
+}
+
+func (d *DryRunner) Restart(ctx context.Context, cluster Cluster) error {
+	plan, err := d.Runner.PlanRestart(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return d.write(plan)
+}
+
+func (d *DryRunner) Restore(ctx context.Context, cluster Cluster, snapshot string) error {
+	plan, err := d.Runner.PlanRestore(ctx, cluster, snapshot)
+	if err != nil {
+		return err
+	}
+	return d.write(plan)
+}
@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestPlan_Write(t *testing.T) {
+	plan := &Plan{Cluster: Cluster{Name: "dev", Project: "demo", Location: "us-central1"}, Status: STATUS_DOWN}
+	plan.Add(Operation{Type: OP_SET_LABELS, Labels: map[string]string{STATUS_LABEL: STATUS_DOWN, "cs-pool-size": "true_3_1_5"}})
+	plan.Add(Operation{Type: OP_SET_AUTOSCALING, NodeGroup: "pool"})
+	plan.Add(Operation{Type: OP_SET_SIZE, NodeGroup: "pool"})
+	plan.Add(Operation{Type: OP_SET_AUTOSCALING, NodeGroup: "pool", Autoscaling: true, MinNodeCount: 1, MaxNodeCount: 5})
+	plan.Add(Operation{Type: OP_SET_SCALING, NodeGroup: "group", NodeCount: 3, MinNodeCount: 1, MaxNodeCount: 5})
+	var buf bytes.Buffer
+	if err := plan.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "cluster demo/dev (us-central1): stop\n" +
+		"  set labels: cs-pool-size=true_3_1_5, cs-status=down\n" +
+		"  node pool pool: disable autoscaling\n" +
+		"  node pool pool: set size: 0\n" +
+		"  node pool pool: enable autoscaling: min 1, max 5\n" +
+		"  node pool group: set scaling: min 1, desired 3, max 5\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Write() = %q, want %q", got, want)
+	}
+}
+
+func TestDryRunner(t *testing.T) {
+	runner := &fakeRunner{}
+	var buf bytes.Buffer
+	dry := &DryRunner{Runner: runner, Out: &buf}
+	if err := dry.Stop(context.Background(), Cluster{Name: "dev", Location: "eu"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dry.Restart(context.Background(), Cluster{Name: "dev", Location: "eu"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.stopped) != 0 || len(runner.restarted) != 0 {
+		t.Errorf("DryRunner called runner: stopped %v, restarted %v", runner.stopped, runner.restarted)
+	}
+	want := "cluster dev (eu): stop\n  set labels: cs-status=down\ncluster dev (eu): nothing to restart\n"
+	if got := buf.String(); got != want {
+		t.Errorf("DryRunner output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// keep_FORMAT is node group stop policy label: 'cs-keep-<node group>'
+	keep_FORMAT = "cs-keep-%s"
+	// KEEP_SKIP is stop policy label value to leave node group running as is
+	KEEP_SKIP = "skip"
+)
+
+// StopPolicy defines how node group is stopped: scaled to 0 (default), scaled to Keep nodes or skipped
+type StopPolicy struct {
+	// Skip leaves node group running as is
+	Skip bool
+	// Keep is number of nodes to keep running (per zone for GKE node pools)
+	Keep int32
+}
+
+func (p StopPolicy) String() string {
+	if p.Skip {
+		return KEEP_SKIP
+	}
+	return strconv.Itoa(int(p.Keep))
+}
+
+// GetKeepLabel returns name of stop policy label of node group
+func GetKeepLabel(name string) string {
+	return fmt.Sprintf(keep_FORMAT, name)
+}
+
+// ParseStopPolicy reads node group stop policy from 'cs-keep-<node group>' label: 'skip' or number of nodes to keep
+func ParseStopPolicy(name string, labels map[string]string) (StopPolicy, error) {
+	value, ok := labels[GetKeepLabel(name)]
+	if !ok || value == "" {
+		return StopPolicy{}, nil
+	}
+	if value == KEEP_SKIP {
+		return StopPolicy{Skip: true}, nil
+	}
+	keep, err := strconv.ParseUint(value, 10, 31)
+	if err != nil {
+		return StopPolicy{}, errors.Errorf("invalid %s label value '%s': want '%s' or number of nodes", GetKeepLabel(name), value, KEEP_SKIP)
+	}
+	return StopPolicy{Keep: int32(keep)}, nil
+}
+
+// StopSize returns node group size after stop, never above the current size; false if node group is skipped
+func (ng NodeGroup) StopSize() (int32, bool) {
+	if ng.Stop.Skip {
+		return 0, false
+	}
+	if ng.Stop.Keep > ng.NodeCount {
+		return ng.NodeCount, true
+	}
+	return ng.Stop.Keep, true
+}
+
+// ParseStopPolicies reads stop policies of cluster node groups from cluster labels
+func (c *Cluster) ParseStopPolicies() error {
+	for i := range c.Nodes {
+		policy, err := ParseStopPolicy(c.Nodes[i].Name, c.Labels)
+		if err != nil {
+			return err
+		}
+		c.Nodes[i].Stop = policy
+	}
+	return nil
+}
+
+// StoppedNodeGroups returns node groups changed on stop and restored on restart: all but skipped ones
+func (c Cluster) StoppedNodeGroups() []NodeGroup {
+	groups := make([]NodeGroup, 0, len(c.Nodes))
+	for _, ng := range c.Nodes {
+		if !ng.Stop.Skip {
+			groups = append(groups, ng)
+		}
+	}
+	return groups
+}
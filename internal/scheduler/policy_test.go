@@ -0,0 +1,53 @@
+package scheduler
+
+import "testing"
+
+func TestParseStopPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    StopPolicy
+		wantErr bool
+	}{
+		{name: "default", labels: map[string]string{}, want: StopPolicy{}},
+		{name: "scale to 0", labels: map[string]string{"cs-keep-pool": "0"}, want: StopPolicy{}},
+		{name: "keep nodes", labels: map[string]string{"cs-keep-pool": "2"}, want: StopPolicy{Keep: 2}},
+		{name: "skip", labels: map[string]string{"cs-keep-pool": "skip"}, want: StopPolicy{Skip: true}},
+		{name: "other pool", labels: map[string]string{"cs-keep-system": "skip"}, want: StopPolicy{}},
+		{name: "negative", labels: map[string]string{"cs-keep-pool": "-1"}, wantErr: true},
+		{name: "invalid", labels: map[string]string{"cs-keep-pool": "all"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStopPolicy("pool", tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseStopPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseStopPolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeGroup_StopSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		ng     NodeGroup
+		want   int32
+		wantOk bool
+	}{
+		{name: "default", ng: NodeGroup{NodeCount: 3}, want: 0, wantOk: true},
+		{name: "keep", ng: NodeGroup{NodeCount: 3, Stop: StopPolicy{Keep: 1}}, want: 1, wantOk: true},
+		{name: "keep more than running", ng: NodeGroup{NodeCount: 1, Stop: StopPolicy{Keep: 2}}, want: 1, wantOk: true},
+		{name: "skip", ng: NodeGroup{NodeCount: 3, Stop: StopPolicy{Skip: true}}, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.ng.StopSize()
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("StopSize() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DesiredStatus returns cluster status (up or down) required by cluster schedule at time t
+func (c *Cluster) DesiredStatus(t time.Time) string {
+	_, ok := c.Schedule.IsInRange(t)
+	return statusOf(ok)
+}
+
+// NextTransition returns the first time after t when cluster desired status changes, and the new status
+func (c *Cluster) NextTransition(t time.Time) (time.Time, string) {
+	return c.Schedule.NextTransition(t)
+}
+
+// DesiredNodeGroupStatus returns node group status (up or down) required by node group own schedule,
+// or cluster schedule for node group without one, at time t
+func (c *Cluster) DesiredNodeGroupStatus(ng NodeGroup, t time.Time) string {
+	if ng.Schedule != nil {
+		_, ok := ng.Schedule.IsInRange(t)
+		return statusOf(ok)
+	}
+	return c.DesiredStatus(t)
+}
+
+// ScheduledStop returns cluster with node groups that should be stopped at time t; false if nothing to stop.
+// Node group (cluster) without status label is considered running.
+func (c Cluster) ScheduledStop(t time.Time) (Cluster, bool) {
+	return c.filter(func(ng NodeGroup) bool {
+		return c.DesiredNodeGroupStatus(ng, t) == STATUS_DOWN && c.NodeGroupStatus(ng) != STATUS_DOWN
+	}, c.DesiredStatus(t) == STATUS_DOWN && c.Status != STATUS_DOWN)
+}
+
+// ScheduledRestart returns cluster with previously stopped node groups that should be restarted at time t;
+// false if nothing to restart
+func (c Cluster) ScheduledRestart(t time.Time) (Cluster, bool) {
+	return c.filter(func(ng NodeGroup) bool {
+		return c.DesiredNodeGroupStatus(ng, t) == STATUS_UP && c.NodeGroupStatus(ng) == STATUS_DOWN
+	}, c.DesiredStatus(t) == STATUS_UP && c.Status == STATUS_DOWN)
+}
+
+// NeedsStop reports whether cluster or some of its node groups should be stopped at time t
+func (c *Cluster) NeedsStop(t time.Time) bool {
+	_, ok := c.ScheduledStop(t)
+	return ok
+}
+
+// NeedsRestart reports whether previously stopped cluster or some of its node groups should be restarted at time t
+func (c *Cluster) NeedsRestart(t time.Time) bool {
+	_, ok := c.ScheduledRestart(t)
+	return ok
+}
+
+// StopGuard reports running workloads that must not be interrupted by scheduled stop
+type StopGuard interface {
+	// Protected returns protected workloads running on cluster node groups
+	Protected(ctx context.Context, cluster Cluster) ([]string, error)
+}
+
+// ReconcileOptions controls reconcile of multiple clusters
+type ReconcileOptions struct {
+	RunOptions
+	// Guard postpones scheduled stop while protected workloads are running; nil disables the check
+	Guard StopGuard
+	// MaxStopDelay is max time scheduled stop is postponed for, since it became due
+	MaxStopDelay time.Duration
+}
+
+// Reconcile stops or restarts clusters node groups to match their schedule at time t, processing clusters with Run.
+// Node groups with own schedule are stopped and restarted independently of the rest of the cluster.
+// When some node groups need restart and others need stop, only restart is done: cluster labels are
+// changed by both, so stop is left to the next reconcile (with updated labels).
+func Reconcile(ctx context.Context, runner Runner, clusters []Cluster, t time.Time, opts ReconcileOptions) (*Summary, error) {
+	return Run(ctx, clusters, opts.RunOptions, func(ctx context.Context, c Cluster) error {
+		logger := log.WithFields(log.Fields{
+			"cluster": c.Name,
+			"status":  c.Status,
+			"desired": c.DesiredStatus(t),
+		})
+		if restart, ok := c.ScheduledRestart(t); ok {
+			logger.WithField("node-groups", nodeGroupNames(restart)).Info("cluster is in uptime range")
+			if err := runner.Restart(ctx, restart); err != nil {
+				return errors.Wrap(err, "failed to restart cluster")
+			}
+			if c.NeedsStop(t) {
+				logger.Info("postpone stop of other node groups to the next reconcile")
+			}
+			return nil
+		}
+		if stop, ok := c.ScheduledStop(t); ok {
+			logger = logger.WithField("node-groups", nodeGroupNames(stop))
+			if postpone(ctx, logger, opts, stop, t) {
+				return nil
+			}
+			logger.Info("cluster is out of uptime range")
+			if err := runner.Stop(ctx, stop); err != nil {
+				return errors.Wrap(err, "failed to stop cluster")
+			}
+			return nil
+		}
+		logger.Debug("cluster is in desired status")
+		return nil
+	})
+}
+
+// postpone reports whether scheduled stop of cluster node groups is postponed to the next reconcile:
+// protected workloads are running (or guard check failed) and stop became due less than MaxStopDelay ago
+func postpone(ctx context.Context, logger *log.Entry, opts ReconcileOptions, stop Cluster, t time.Time) bool {
+	if opts.Guard == nil {
+		return false
+	}
+	due := stop.StopDue(t.Add(-opts.MaxStopDelay), t)
+	if due.IsZero() {
+		return false
+	}
+	logger = logger.WithField("due", due)
+	workloads, err := opts.Guard.Protected(ctx, stop)
+	if err != nil {
+		logger.WithError(err).Warn("postpone stop: failed to check protected workloads")
+		return true
+	}
+	if len(workloads) == 0 {
+		return false
+	}
+	logger.WithField("workloads", workloads).Warn("postpone stop: protected workloads are running")
+	return true
+}
+
+// StopDue returns time in (since, t] when stop of all cluster node groups became due: the earliest of the
+// last transitions to down of their schedules; zero time if stop of some node group became due before since
+func (c *Cluster) StopDue(since, t time.Time) time.Time {
+	if len(c.Nodes) == 0 {
+		return c.Schedule.LastStop(since, t)
+	}
+	var due time.Time
+	for _, ng := range c.Nodes {
+		schedule := &c.Schedule
+		if ng.Schedule != nil {
+			schedule = ng.Schedule
+		}
+		last := schedule.LastStop(since, t)
+		if last.IsZero() {
+			return time.Time{}
+		}
+		if due.IsZero() || last.Before(due) {
+			due = last
+		}
+	}
+	return due
+}
+
+func nodeGroupNames(c Cluster) []string {
+	names := make([]string, 0, len(c.Nodes))
+	for _, ng := range c.Nodes {
+		names = append(names, ng.Name)
+	}
+	return names
+}
+
+// NextReconcile returns duration till the earliest cluster or node group transition after t, but not longer than interval
+func NextReconcile(clusters []Cluster, t time.Time, interval time.Duration) time.Duration {
+	wait := interval
+	next := func(schedule *Schedule) {
+		if at, status := schedule.NextTransition(t); status != "" && at.Sub(t) < wait {
+			wait = at.Sub(t)
+		}
+	}
+	for _, c := range clusters {
+		next(&c.Schedule)
+		for _, ng := range c.Nodes {
+			if ng.Schedule != nil {
+				next(ng.Schedule)
+			}
+		}
+	}
+	return wait
+}
@@ -0,0 +1,285 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type fakeRunner struct {
+	stopped   []string
+	restarted []string
+	// stopped and restarted node groups
+	stoppedNodes   []string
+	restartedNodes []string
+}
+
+func (f *fakeRunner) List(context.Context) ([]Cluster, error) {
+	return nil, nil
+}
+
+func (f *fakeRunner) Stop(_ context.Context, c Cluster) error {
+	f.stopped = append(f.stopped, c.Name)
+	f.stoppedNodes = append(f.stoppedNodes, nodeGroupNames(c)...)
+	return nil
+}
+
+func (f *fakeRunner) Restart(_ context.Context, c Cluster) error {
+	f.restarted = append(f.restarted, c.Name)
+	f.restartedNodes = append(f.restartedNodes, nodeGroupNames(c)...)
+	return nil
+}
+
+func (f *fakeRunner) PlanStop(_ context.Context, c Cluster) (*Plan, error) {
+	plan := &Plan{Cluster: c, Status: STATUS_DOWN}
+	plan.Add(Operation{Type: OP_SET_LABELS, Labels: map[string]string{STATUS_LABEL: STATUS_DOWN}})
+	return plan, nil
+}
+
+func (f *fakeRunner) PlanRestart(_ context.Context, c Cluster) (*Plan, error) {
+	return &Plan{Cluster: c, Status: STATUS_UP}, nil
+}
+
+func (f *fakeRunner) Restore(_ context.Context, c Cluster, _ string) error {
+	f.restarted = append(f.restarted, c.Name)
+	return nil
+}
+
+func (f *fakeRunner) PlanRestore(_ context.Context, c Cluster, _ string) (*Plan, error) {
+	return &Plan{Cluster: c, Status: STATUS_UP}, nil
+}
+
+func TestReconcile(t *testing.T) {
+	// working hours on weekdays
+	uptime := UptimeRange{Minutes: Range{8 * 60, 19 * 60}, Weekdays: Range{1, 6}, Days: Range{1, 32}, Months: Range{1, 13}}
+	schedule := Schedule{Windows: []Window{&uptime}}
+	clusters := []Cluster{
+		{Name: "new", Schedule: schedule},
+		{Name: "up", Status: STATUS_UP, Schedule: schedule},
+		{Name: "down", Status: STATUS_DOWN, Schedule: schedule},
+	}
+	tests := []struct {
+		name      string
+		t         time.Time
+		stopped   []string
+		restarted []string
+	}{
+		{
+			name:    "out of uptime range",
+			t:       time.Date(2020, 4, 15, 22, 0, 0, 0, time.UTC),
+			stopped: []string{"new", "up"},
+		},
+		{
+			name:      "in uptime range",
+			t:         time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC),
+			restarted: []string{"down"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeRunner{}
+			if _, err := Reconcile(context.Background(), runner, clusters, tt.t, ReconcileOptions{RunOptions: RunOptions{Concurrency: 1}}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if !equal(runner.stopped, tt.stopped) {
+				t.Errorf("Reconcile() stopped = %v, want %v", runner.stopped, tt.stopped)
+			}
+			if !equal(runner.restarted, tt.restarted) {
+				t.Errorf("Reconcile() restarted = %v, want %v", runner.restarted, tt.restarted)
+			}
+		})
+	}
+}
+
+func TestReconcileNodeGroups(t *testing.T) {
+	// cluster in working hours, batch node group at night
+	uptime := UptimeRange{Minutes: Range{8 * 60, 19 * 60}, Weekdays: Range{1, 6}, Days: Range{1, 32}, Months: Range{1, 13}}
+	night := UptimeRange{Minutes: Range{0, 6 * 60}, Weekdays: Range{0, 7}, Days: Range{1, 32}, Months: Range{1, 13}}
+	batch := &Schedule{Windows: []Window{&night}}
+	tests := []struct {
+		name           string
+		t              time.Time
+		clusterStatus  string
+		batchStatus    string
+		stoppedNodes   []string
+		restartedNodes []string
+	}{
+		{
+			name:          "stop batch node group in working hours",
+			t:             time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC),
+			clusterStatus: STATUS_UP,
+			stoppedNodes:  []string{"batch"},
+		},
+		{
+			name:          "stop cluster node groups in the evening",
+			t:             time.Date(2020, 4, 15, 20, 0, 0, 0, time.UTC),
+			clusterStatus: STATUS_UP,
+			batchStatus:   STATUS_DOWN,
+			stoppedNodes:  []string{"default", "system"},
+		},
+		{
+			name:           "restart batch node group at night",
+			t:              time.Date(2020, 4, 15, 1, 0, 0, 0, time.UTC),
+			clusterStatus:  STATUS_DOWN,
+			batchStatus:    STATUS_DOWN,
+			restartedNodes: []string{"batch"},
+		},
+		{
+			name:           "restart before stop",
+			t:              time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC),
+			clusterStatus:  STATUS_DOWN,
+			batchStatus:    STATUS_UP,
+			restartedNodes: []string{"default", "system"},
+		},
+		{
+			name:          "in desired status",
+			t:             time.Date(2020, 4, 15, 20, 0, 0, 0, time.UTC),
+			clusterStatus: STATUS_DOWN,
+			batchStatus:   STATUS_DOWN,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := Cluster{
+				Name:     "dev",
+				Status:   tt.clusterStatus,
+				Schedule: Schedule{Windows: []Window{&uptime}},
+				Nodes: []NodeGroup{
+					{Name: "default"},
+					{Name: "batch", Schedule: batch, Status: tt.batchStatus},
+					{Name: "system"},
+				},
+			}
+			runner := &fakeRunner{}
+			if _, err := Reconcile(context.Background(), runner, []Cluster{cluster}, tt.t, ReconcileOptions{RunOptions: RunOptions{Concurrency: 1}}); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if !equal(runner.stoppedNodes, tt.stoppedNodes) {
+				t.Errorf("Reconcile() stopped = %v, want %v", runner.stoppedNodes, tt.stoppedNodes)
+			}
+			if !equal(runner.restartedNodes, tt.restartedNodes) {
+				t.Errorf("Reconcile() restarted = %v, want %v", runner.restartedNodes, tt.restartedNodes)
+			}
+		})
+	}
+}
+
+type fakeGuard struct {
+	workloads []string
+	err       error
+}
+
+func (g fakeGuard) Protected(context.Context, Cluster) ([]string, error) {
+	return g.workloads, g.err
+}
+
+func TestReconcileStopGuard(t *testing.T) {
+	// stop is due at 19:00
+	uptime := UptimeRange{Minutes: Range{8 * 60, 19 * 60}, Weekdays: Range{1, 6}, Days: Range{1, 32}, Months: Range{1, 13}}
+	// stop is due at 12:00, after 1 hour of uptime
+	short := UptimeRange{Minutes: Range{11 * 60, 12 * 60}, Weekdays: Range{1, 6}, Days: Range{1, 32}, Months: Range{1, 13}}
+	tests := []struct {
+		name    string
+		t       time.Time
+		uptime  *UptimeRange
+		guard   StopGuard
+		stopped []string
+	}{
+		{
+			name:    "no protected workloads",
+			t:       time.Date(2020, 4, 15, 19, 5, 0, 0, time.UTC),
+			guard:   fakeGuard{},
+			stopped: []string{"dev"},
+		},
+		{
+			name:  "running job",
+			t:     time.Date(2020, 4, 15, 19, 5, 0, 0, time.UTC),
+			guard: fakeGuard{workloads: []string{"job default/report"}},
+		},
+		{
+			name:  "guard failure",
+			t:     time.Date(2020, 4, 15, 19, 5, 0, 0, time.UTC),
+			guard: fakeGuard{err: errors.New("cluster API is not reachable")},
+		},
+		{
+			name:    "max stop delay exceeded",
+			t:       time.Date(2020, 4, 15, 21, 5, 0, 0, time.UTC),
+			guard:   fakeGuard{workloads: []string{"job default/report"}},
+			stopped: []string{"dev"},
+		},
+		{
+			name:    "guard disabled",
+			t:       time.Date(2020, 4, 15, 19, 5, 0, 0, time.UTC),
+			stopped: []string{"dev"},
+		},
+		{
+			name:   "uptime shorter than max stop delay",
+			t:      time.Date(2020, 4, 15, 12, 5, 0, 0, time.UTC),
+			uptime: &short,
+			guard:  fakeGuard{workloads: []string{"job default/report"}},
+		},
+		{
+			name:    "uptime shorter than max stop delay exceeded",
+			t:       time.Date(2020, 4, 15, 14, 5, 0, 0, time.UTC),
+			uptime:  &short,
+			guard:   fakeGuard{workloads: []string{"job default/report"}},
+			stopped: []string{"dev"},
+		},
+		{
+			name:    "no uptime day",
+			t:       time.Date(2020, 4, 18, 12, 5, 0, 0, time.UTC),
+			uptime:  &short,
+			guard:   fakeGuard{workloads: []string{"job default/report"}},
+			stopped: []string{"dev"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := &uptime
+			if tt.uptime != nil {
+				window = tt.uptime
+			}
+			cluster := Cluster{Name: "dev", Status: STATUS_UP, Schedule: Schedule{Windows: []Window{window}}, Nodes: []NodeGroup{{Name: "default"}}}
+			runner := &fakeRunner{}
+			opts := ReconcileOptions{RunOptions: RunOptions{Concurrency: 1}, Guard: tt.guard, MaxStopDelay: 2 * time.Hour}
+			if _, err := Reconcile(context.Background(), runner, []Cluster{cluster}, tt.t, opts); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if !equal(runner.stopped, tt.stopped) {
+				t.Errorf("Reconcile() stopped = %v, want %v", runner.stopped, tt.stopped)
+			}
+		})
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNextReconcile(t *testing.T) {
+	uptime := UptimeRange{Minutes: Range{8 * 60, 19 * 60}, Weekdays: Range{1, 6}, Days: Range{1, 32}, Months: Range{1, 13}}
+	clusters := []Cluster{{Name: "dev", Schedule: Schedule{Windows: []Window{&uptime}}}}
+	now := time.Date(2020, 4, 15, 18, 30, 0, 0, time.UTC)
+	if got := NextReconcile(clusters, now, time.Hour); got != 30*time.Minute {
+		t.Errorf("NextReconcile() = %v, want %v", got, 30*time.Minute)
+	}
+	if got := NextReconcile(clusters, now, 10*time.Minute); got != 10*time.Minute {
+		t.Errorf("NextReconcile() = %v, want %v", got, 10*time.Minute)
+	}
+	// node group with own schedule
+	night := UptimeRange{Minutes: Range{0, 18*60 + 45}, Weekdays: Range{0, 7}, Days: Range{1, 32}, Months: Range{1, 13}}
+	clusters[0].Nodes = []NodeGroup{{Name: "batch", Schedule: &Schedule{Windows: []Window{&night}}}}
+	if got := NextReconcile(clusters, now, time.Hour); got != 15*time.Minute {
+		t.Errorf("NextReconcile() with node group schedule = %v, want %v", got, 15*time.Minute)
+	}
+}
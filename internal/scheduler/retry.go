@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	default_RETRY_ATTEMPTS  = 8
+	default_RETRY_DELAY     = time.Second * 2
+	default_RETRY_MAX_DELAY = time.Minute
+)
+
+// RetryPolicy retries transient cloud API errors with exponential backoff and jitter
+type RetryPolicy struct {
+	// Attempts is max number of calls, including the first one
+	Attempts int
+	// Delay before the first retry; doubled for every next retry
+	Delay time.Duration
+	// MaxDelay limits delay between retries
+	MaxDelay time.Duration
+	// Retryable classifies errors worth retrying: backend specific (gRPC codes, AWS error codes)
+	Retryable func(error) bool
+}
+
+// NewRetryPolicy returns default retry policy with retryable errors classifier
+func NewRetryPolicy(retryable func(error) bool) RetryPolicy {
+	return RetryPolicy{
+		Attempts:  default_RETRY_ATTEMPTS,
+		Delay:     default_RETRY_DELAY,
+		MaxDelay:  default_RETRY_MAX_DELAY,
+		Retryable: retryable,
+	}
+}
+
+// backoff returns delay before retry (1-based): exponential delay with "equal jitter",
+// so concurrent workers hitting the same API limit do not retry in lockstep
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.Delay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// Do calls fn until it succeeds, fails with non-retryable error, attempts are exhausted or ctx is done
+func (p RetryPolicy) Do(ctx context.Context, name string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt >= p.Attempts || p.Retryable == nil || !p.Retryable(err) {
+			return err
+		}
+		delay := p.backoff(attempt)
+		log.WithFields(log.Fields{
+			"call":    name,
+			"attempt": attempt,
+			"delay":   delay,
+		}).WithError(err).Warn("retrying transient cloud API error")
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
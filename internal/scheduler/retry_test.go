@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("transient")
+
+func TestRetryPolicy_Do(t *testing.T) {
+	tests := []struct {
+		name    string
+		errs    []error
+		wantErr error
+		calls   int
+	}{
+		{
+			name:  "success",
+			calls: 1,
+		},
+		{
+			name:  "retry transient errors",
+			errs:  []error{errTransient, errTransient},
+			calls: 3,
+		},
+		{
+			name:    "give up after max attempts",
+			errs:    []error{errTransient, errTransient, errTransient, errTransient},
+			wantErr: errTransient,
+			calls:   3,
+		},
+		{
+			name:    "do not retry permanent error",
+			errs:    []error{errors.New("permanent")},
+			wantErr: errors.New("permanent"),
+			calls:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := RetryPolicy{
+				Attempts:  3,
+				Delay:     time.Millisecond,
+				Retryable: func(err error) bool { return err == errTransient },
+			}
+			calls := 0
+			err := p.Do(context.Background(), "test", func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if (err == nil) != (tt.wantErr == nil) || err != nil && err.Error() != tt.wantErr.Error() {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.calls {
+				t.Errorf("Do() calls = %d, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewRetryPolicy(func(error) bool { return true })
+	calls := 0
+	err := p.Do(ctx, "test", func() error {
+		calls++
+		cancel()
+		return errTransient
+	})
+	if err != errTransient || calls != 1 {
+		t.Errorf("Do() error = %v, calls = %d, want last error after 1 call", err, calls)
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{Delay: time.Second, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{4, 2500 * time.Millisecond, 5 * time.Second},
+		{10, 2500 * time.Millisecond, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 10; i++ {
+			if got := p.backoff(tt.retry); got < tt.min || got > tt.max {
+				t.Errorf("backoff(%d) = %v, want in [%v, %v]", tt.retry, got, tt.min, tt.max)
+			}
+		}
+	}
+}
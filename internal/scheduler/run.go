@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// NodeGroupError is an error from node group (node pool) operation
+type NodeGroupError struct {
+	NodeGroup string
+	Err       error
+}
+
+func (e *NodeGroupError) Error() string {
+	return fmt.Sprintf("node group %s: %v", e.NodeGroup, e.Err)
+}
+
+func (e *NodeGroupError) Unwrap() error {
+	return e.Err
+}
+
+// NodeGroupFailure attributes err to node group; cluster level errors (empty node group name) are returned as is
+func NodeGroupFailure(nodeGroup string, err error) error {
+	if err == nil || nodeGroup == "" {
+		return err
+	}
+	return &NodeGroupError{NodeGroup: nodeGroup, Err: err}
+}
+
+// ClusterError is an error from cluster operation
+type ClusterError struct {
+	Cluster   string
+	NodeGroup string
+	Err       error
+}
+
+func (e *ClusterError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Cluster, e.Err)
+}
+
+func (e *ClusterError) Unwrap() error {
+	return e.Err
+}
+
+func newClusterError(c *Cluster, err error) *ClusterError {
+	ce := &ClusterError{Cluster: c.ID(), Err: err}
+	var ng *NodeGroupError
+	if errors.As(err, &ng) {
+		ce.NodeGroup = ng.NodeGroup
+	}
+	return ce
+}
+
+// Errors aggregates errors from multiple clusters
+type Errors []*ClusterError
+
+func (e Errors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+	return fmt.Sprintf("%d cluster(s) failed:\n  %s", len(e), strings.Join(lines, "\n  "))
+}
+
+// ID returns unique cluster identifier: project/location/name
+func (c *Cluster) ID() string {
+	id := c.Location + "/" + c.Name
+	if c.Project != "" {
+		id = c.Project + "/" + id
+	}
+	return id
+}
+
+// RunOptions controls processing of multiple clusters
+type RunOptions struct {
+	// Concurrency is max number of clusters processed in parallel
+	Concurrency int
+	// FailFast stops processing of remaining clusters after the first error
+	FailFast bool
+	// Graceful completes operations of clusters in progress when context is canceled: cancellation
+	// only stops processing of remaining clusters
+	Graceful bool
+}
+
+// Summary is a result of processing multiple clusters
+type Summary struct {
+	Succeeded []string
+	Failed    Errors
+	// Skipped clusters were not processed due to fail-fast or cancellation
+	Skipped []string
+}
+
+// Err returns aggregated cluster errors, if any
+func (s *Summary) Err() error {
+	if len(s.Failed) > 0 {
+		return s.Failed
+	}
+	return nil
+}
+
+// Write writes human-readable summary
+func (s *Summary) Write(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d succeeded, %d failed, %d skipped\n", len(s.Succeeded), len(s.Failed), len(s.Skipped))
+	for _, e := range s.Failed {
+		fmt.Fprintf(&b, "  FAILED  %s: %v\n", e.Cluster, e.Err)
+	}
+	for _, id := range s.Skipped {
+		fmt.Fprintf(&b, "  SKIPPED %s\n", id)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Run calls fn for clusters using up to opts.Concurrency parallel workers; clusters with read error are reported as failed.
+// Each cluster is processed by a single worker, so operations on the same cluster are serialized
+// (GKE allows one operation per cluster at a time). Errors do not stop processing of other clusters,
+// unless opts.FailFast is set; all errors are reported in Summary and returned as Errors.
+func Run(ctx context.Context, clusters []Cluster, opts RunOptions, fn func(context.Context, Cluster) error) (*Summary, error) {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	// context of cluster operations
+	opCtx := ctx
+	if opts.Graceful {
+		opCtx = context.Background()
+	}
+	queue := make(chan int)
+	var (
+		mu      sync.Mutex
+		results = make([]error, len(clusters))
+		done    = make([]bool, len(clusters))
+		failed  = make(chan struct{})
+		once    sync.Once
+		wg      sync.WaitGroup
+	)
+	stopped := func() bool {
+		select {
+		case <-failed:
+			return true
+		case <-ctx.Done():
+			return true
+		default:
+			return false
+		}
+	}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				// skip clusters dispatched concurrently with fail-fast error or cancellation
+				if stopped() {
+					continue
+				}
+				err := clusters[i].Err
+				if err == nil {
+					err = fn(opCtx, clusters[i])
+				}
+				mu.Lock()
+				results[i], done[i] = err, true
+				mu.Unlock()
+				if err != nil && opts.FailFast {
+					once.Do(func() { close(failed) })
+				}
+			}
+		}()
+	}
+	for i := range clusters {
+		if stopped() {
+			break
+		}
+		select {
+		case queue <- i:
+		case <-failed:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+	// report clusters in original order
+	summary := &Summary{}
+	for i := range clusters {
+		switch {
+		case !done[i]:
+			summary.Skipped = append(summary.Skipped, clusters[i].ID())
+		case results[i] != nil:
+			summary.Failed = append(summary.Failed, newClusterError(&clusters[i], results[i]))
+		default:
+			summary.Succeeded = append(summary.Succeeded, clusters[i].ID())
+		}
+	}
+	if err := summary.Err(); err != nil {
+		return summary, err
+	}
+	return summary, ctx.Err()
+}
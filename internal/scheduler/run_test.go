@@ -0,0 +1,201 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	clusters := []Cluster{
+		{Name: "a", Location: "us-central1"},
+		{Name: "b", Location: "us-central1"},
+		{Name: "c", Location: "europe-west1", Project: "dev"},
+		{Name: "d", Location: "europe-west1"},
+	}
+	tests := []struct {
+		name      string
+		opts      RunOptions
+		fail      map[string]bool
+		wantMax   int
+		succeeded []string
+		failed    []string
+		skipped   []string
+	}{
+		{
+			name:      "sequential",
+			opts:      RunOptions{Concurrency: 1},
+			wantMax:   1,
+			succeeded: []string{"us-central1/a", "us-central1/b", "dev/europe-west1/c", "europe-west1/d"},
+		},
+		{
+			name:      "parallel",
+			opts:      RunOptions{Concurrency: 4},
+			wantMax:   4,
+			succeeded: []string{"us-central1/a", "us-central1/b", "dev/europe-west1/c", "europe-west1/d"},
+		},
+		{
+			name:      "invalid concurrency",
+			opts:      RunOptions{Concurrency: 0},
+			wantMax:   1,
+			succeeded: []string{"us-central1/a", "us-central1/b", "dev/europe-west1/c", "europe-west1/d"},
+		},
+		{
+			name:      "continue on error",
+			opts:      RunOptions{Concurrency: 1},
+			fail:      map[string]bool{"a": true, "c": true},
+			wantMax:   1,
+			succeeded: []string{"us-central1/b", "europe-west1/d"},
+			failed:    []string{"us-central1/a", "dev/europe-west1/c"},
+		},
+		{
+			name:    "fail fast",
+			opts:    RunOptions{Concurrency: 1, FailFast: true},
+			fail:    map[string]bool{"a": true},
+			wantMax: 1,
+			failed:  []string{"us-central1/a"},
+			skipped: []string{"us-central1/b", "dev/europe-west1/c", "europe-west1/d"},
+		},
+		{
+			name:      "fail fast with running clusters",
+			opts:      RunOptions{Concurrency: 4, FailFast: true},
+			fail:      map[string]bool{"a": true, "c": true},
+			wantMax:   4,
+			succeeded: []string{"us-central1/b", "europe-west1/d"},
+			failed:    []string{"us-central1/a", "dev/europe-west1/c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu          sync.Mutex
+				running     int
+				maxRunning  int
+				allStarted  = make(chan struct{})
+				startedOnce sync.Once
+			)
+			summary, err := Run(context.Background(), clusters, tt.opts, func(ctx context.Context, c Cluster) error {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				if running == tt.wantMax {
+					startedOnce.Do(func() { close(allStarted) })
+				}
+				mu.Unlock()
+				// wait till all workers are busy to check concurrency limit
+				select {
+				case <-allStarted:
+				case <-time.After(time.Second):
+				}
+				mu.Lock()
+				running--
+				mu.Unlock()
+				if tt.fail[c.Name] {
+					return errors.New("failed")
+				}
+				return nil
+			})
+			if maxRunning != tt.wantMax {
+				t.Errorf("Run() max parallel = %d, want %d", maxRunning, tt.wantMax)
+			}
+			if (err != nil) != (len(tt.failed) > 0) {
+				t.Errorf("Run() error = %v, want failed %v", err, tt.failed)
+			}
+			var failed []string
+			for _, e := range summary.Failed {
+				failed = append(failed, e.Cluster)
+			}
+			if !equal(summary.Succeeded, tt.succeeded) {
+				t.Errorf("Run() succeeded = %v, want %v", summary.Succeeded, tt.succeeded)
+			}
+			if !equal(failed, tt.failed) {
+				t.Errorf("Run() failed = %v, want %v", failed, tt.failed)
+			}
+			if !equal(summary.Skipped, tt.skipped) {
+				t.Errorf("Run() skipped = %v, want %v", summary.Skipped, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestRun_ClusterError(t *testing.T) {
+	clusters := []Cluster{
+		{Name: "a", Location: "us-central1", Err: errors.New("invalid uptime")},
+		{Name: "b", Location: "us-central1"},
+	}
+	var called []string
+	summary, err := Run(context.Background(), clusters, RunOptions{Concurrency: 1}, func(ctx context.Context, c Cluster) error {
+		called = append(called, c.Name)
+		return nil
+	})
+	if err == nil || len(summary.Failed) != 1 || summary.Failed[0].Cluster != "us-central1/a" {
+		t.Errorf("Run() error = %v, want cluster us-central1/a failed", err)
+	}
+	if !equal(called, []string{"b"}) || !equal(summary.Succeeded, []string{"us-central1/b"}) {
+		t.Errorf("Run() processed %v, succeeded %v, want only cluster b", called, summary.Succeeded)
+	}
+}
+
+func TestRun_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary, err := Run(ctx, []Cluster{{Name: "a"}}, RunOptions{Concurrency: 1}, func(ctx context.Context, c Cluster) error {
+		t.Errorf("Run() processed cluster %s after cancel", c.Name)
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+	}
+	if len(summary.Skipped) != 1 {
+		t.Errorf("Run() skipped = %v, want 1 cluster", summary.Skipped)
+	}
+}
+
+func TestRun_Graceful(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	clusters := []Cluster{{Name: "a", Location: "eu"}, {Name: "b", Location: "eu"}}
+	var called []string
+	summary, err := Run(ctx, clusters, RunOptions{Concurrency: 1, Graceful: true}, func(opCtx context.Context, c Cluster) error {
+		called = append(called, c.Name)
+		// termination signal during cluster operation
+		cancel()
+		return opCtx.Err()
+	})
+	if err != context.Canceled {
+		t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+	}
+	if !equal(called, []string{"a"}) || !equal(summary.Succeeded, []string{"eu/a"}) || !equal(summary.Skipped, []string{"eu/b"}) {
+		t.Errorf("Run() processed %v, succeeded %v, skipped %v, want a completed and b skipped", called, summary.Succeeded, summary.Skipped)
+	}
+}
+
+func TestSummary_Write(t *testing.T) {
+	clusters := []Cluster{{Name: "a", Location: "eu"}, {Name: "b", Location: "eu"}}
+	summary := &Summary{
+		Succeeded: []string{"eu/c"},
+		Failed: Errors{
+			newClusterError(&clusters[0], errors.New("quota exceeded")),
+			newClusterError(&clusters[1], NodeGroupFailure("pool", errors.New("timeout"))),
+		},
+		Skipped: []string{"eu/d"},
+	}
+	if summary.Failed[1].NodeGroup != "pool" {
+		t.Errorf("NodeGroup = %q, want %q", summary.Failed[1].NodeGroup, "pool")
+	}
+	var buf bytes.Buffer
+	if err := summary.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "1 succeeded, 2 failed, 1 skipped\n" +
+		"  FAILED  eu/a: quota exceeded\n" +
+		"  FAILED  eu/b: node group pool: timeout\n" +
+		"  SKIPPED eu/d\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Write() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,204 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// max number of window transitions and calendar days to check for schedule transition
+	schedule_SEARCH_STEPS = 1000
+)
+
+// Window is a recurring time window the cluster is supposed to run in
+type Window interface {
+	fmt.Stringer
+	IsInRange(t time.Time) bool
+	// NextTransition returns the first time after t when IsInRange result changes and status after it
+	NextTransition(t time.Time) (time.Time, string)
+}
+
+// Schedule is a set of uptime windows: cluster is up if any window matches,
+// unless calendar overrides windows for the day
+type Schedule struct {
+	Windows  []Window
+	Calendar *Calendar
+	// time zone of calendar days; time location is used when nil
+	Location *time.Location
+}
+
+// ParseSchedule parses cluster schedule from 'cs-uptime' and numbered 'cs-uptime-N' labels,
+// 'cs-start-cron' and 'cs-stop-cron' labels, 'cs-calendar' label and 'cs-timezone' label, applied to all windows;
+// 'cs-calendar' label refers to one of calendars
+func ParseSchedule(labels map[string]string, calendars Calendars) (*Schedule, error) {
+	loc, err := ParseTimezone(labels[TIMEZONE_LABEL])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid time zone")
+	}
+	schedule := &Schedule{Location: loc}
+	if name := labels[CALENDAR_LABEL]; name != "" {
+		cal, ok := calendars[name]
+		if !ok {
+			return nil, errors.Errorf("unknown calendar '%s'", name)
+		}
+		schedule.Calendar = cal
+	}
+	// collect uptime specs: 'cs-uptime' first, then 'cs-uptime-N' ordered by N
+	var specs []string
+	if spec, ok := labels[UPTIME_LABEL]; ok {
+		specs = append(specs, spec)
+	}
+	var numbers []int
+	for key := range labels {
+		if !strings.HasPrefix(key, UPTIME_LABEL+"-") {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, UPTIME_LABEL+"-"))
+		if err != nil {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	for _, n := range numbers {
+		specs = append(specs, labels[UPTIME_LABEL+"-"+strconv.Itoa(n)])
+	}
+	for _, spec := range specs {
+		uptime, err := ParseUptime(spec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid uptime '%s'", spec)
+		}
+		uptime.Location = loc
+		schedule.Windows = append(schedule.Windows, uptime)
+	}
+	// cron window: both 'start' and 'stop' events are required
+	start, hasStart := labels[START_CRON_LABEL]
+	stop, hasStop := labels[STOP_CRON_LABEL]
+	if hasStart != hasStop {
+		return nil, errors.Errorf("both '%s' and '%s' labels are required", START_CRON_LABEL, STOP_CRON_LABEL)
+	}
+	if hasStart {
+		cron, err := ParseCronRange(start, stop)
+		if err != nil {
+			return nil, err
+		}
+		cron.Location = loc
+		schedule.Windows = append(schedule.Windows, cron)
+	}
+	if len(schedule.Windows) == 0 {
+		return nil, errors.New("missing cluster uptime label")
+	}
+	return schedule, nil
+}
+
+// String returns schedule windows, calendar and non-UTC time zone
+func (s *Schedule) String() string {
+	var parts []string
+	for _, w := range s.Windows {
+		parts = append(parts, w.String())
+	}
+	result := strings.Join(parts, " | ")
+	if s.Calendar != nil {
+		result += " calendar:" + s.Calendar.Name
+	}
+	if s.Location != nil && s.Location != time.UTC {
+		result += " tz:" + s.Location.String()
+	}
+	return result
+}
+
+// IsInRange reports whether t is inside any schedule window and index of the first matching window;
+// index is -1 when calendar overrides schedule windows
+func (s *Schedule) IsInRange(t time.Time) (int, bool) {
+	if s.Calendar != nil {
+		day := t
+		if s.Location != nil {
+			day = t.In(s.Location)
+		}
+		switch s.Calendar.Override(day) {
+		case STATUS_UP:
+			return -1, true
+		case STATUS_DOWN:
+			return -1, false
+		}
+	}
+	for i, w := range s.Windows {
+		if w.IsInRange(t) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// NextTransition returns the first time after t when cluster desired status changes, and the new status;
+// empty status means no transition is found
+func (s *Schedule) NextTransition(from time.Time) (time.Time, string) {
+	_, current := s.IsInRange(from)
+	// windows without any transition
+	static := make([]bool, len(s.Windows))
+	t := from
+	for i := 0; i < schedule_SEARCH_STEPS; i++ {
+		var next time.Time
+		for j, w := range s.Windows {
+			if static[j] {
+				continue
+			}
+			wt, status := w.NextTransition(t)
+			if status == "" {
+				static[j] = true
+				continue
+			}
+			if next.IsZero() || wt.Before(next) {
+				next = wt
+			}
+		}
+		// calendar can override schedule at midnight
+		if s.Calendar != nil {
+			day := t
+			if s.Location != nil {
+				day = t.In(s.Location)
+			}
+			y, m, d := day.Date()
+			midnight := time.Date(y, m, d+1, 0, 0, 0, 0, day.Location())
+			if next.IsZero() || midnight.Before(next) {
+				next = midnight
+			}
+		}
+		if next.IsZero() {
+			return time.Time{}, ""
+		}
+		if _, in := s.IsInRange(next); in != current {
+			return next, statusOf(in)
+		}
+		t = next
+	}
+	return time.Time{}, ""
+}
+
+// LastStop returns the last time in (from, to] when cluster desired status changes from up to down;
+// zero time if there is no such transition
+func (s *Schedule) LastStop(from, to time.Time) time.Time {
+	var last time.Time
+	for t := from; ; {
+		next, status := s.NextTransition(t)
+		if status == "" || next.After(to) {
+			return last
+		}
+		if status == STATUS_DOWN {
+			last = next
+		}
+		t = next
+	}
+}
+
+func statusOf(up bool) string {
+	if up {
+		return STATUS_UP
+	}
+	return STATUS_DOWN
+}
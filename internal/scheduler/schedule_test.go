@@ -0,0 +1,157 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		windows int
+		wantErr bool
+	}{
+		{
+			name:    "single uptime",
+			labels:  map[string]string{UPTIME_LABEL: "8-20_1-6_x_x"},
+			windows: 1,
+		},
+		{
+			name: "numbered uptime",
+			labels: map[string]string{
+				UPTIME_LABEL + "-1": "8-20_1-6_x_x",
+				UPTIME_LABEL + "-2": "10-14_6-0_x_x",
+			},
+			windows: 2,
+		},
+		{
+			name: "uptime and numbered uptime",
+			labels: map[string]string{
+				UPTIME_LABEL:        "8-20_1-6_x_x",
+				UPTIME_LABEL + "-1": "10-14_6-0_x_x",
+				UPTIME_LABEL + "-x": "ignored",
+			},
+			windows: 2,
+		},
+		{
+			name:    "missing uptime",
+			labels:  map[string]string{ENABLED_LABEL: "true"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid numbered uptime",
+			labels:  map[string]string{UPTIME_LABEL: "8-20_1-6_x_x", UPTIME_LABEL + "-1": "8-20"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSchedule(tt.labels, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(got.Windows) != tt.windows {
+				t.Errorf("ParseSchedule() windows = %d, want %d", len(got.Windows), tt.windows)
+			}
+		})
+	}
+}
+
+func TestSchedule_IsInRange(t *testing.T) {
+	// Mon-Fri 8-20 and Sat 10-14
+	schedule, err := ParseSchedule(map[string]string{
+		UPTIME_LABEL + "-1": "8-20_1-6_x_x",
+		UPTIME_LABEL + "-2": "10-14_6-0_x_x",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		t      time.Time
+		window int
+		want   bool
+	}{
+		{name: "weekday", t: time.Date(2020, 4, 15, 9, 0, 0, 0, time.UTC), window: 0, want: true},
+		{name: "saturday", t: time.Date(2020, 4, 18, 11, 0, 0, 0, time.UTC), window: 1, want: true},
+		{name: "saturday evening", t: time.Date(2020, 4, 18, 15, 0, 0, 0, time.UTC), window: -1, want: false},
+		{name: "sunday", t: time.Date(2020, 4, 19, 11, 0, 0, 0, time.UTC), window: -1, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, got := schedule.IsInRange(tt.t)
+			if got != tt.want || window != tt.window {
+				t.Errorf("IsInRange() = %d, %v, want %d, %v", window, got, tt.window, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSchedule_Cron(t *testing.T) {
+	schedule, err := ParseSchedule(map[string]string{
+		START_CRON_LABEL: "0_8_x_x_1-5",
+		STOP_CRON_LABEL:  "0_20_x_x_1-5",
+		TIMEZONE_LABEL:   "europe--berlin",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 19:30 UTC is 21:30 CEST
+	if _, ok := schedule.IsInRange(time.Date(2020, 7, 15, 19, 30, 0, 0, time.UTC)); ok {
+		t.Error("IsInRange() = true, want false")
+	}
+	// 06:30 UTC is 08:30 CEST
+	if _, ok := schedule.IsInRange(time.Date(2020, 7, 15, 6, 30, 0, 0, time.UTC)); !ok {
+		t.Error("IsInRange() = false, want true")
+	}
+	if _, err = ParseSchedule(map[string]string{START_CRON_LABEL: "0_8_x_x_1-5"}, nil); err == nil {
+		t.Error("ParseSchedule() without stop cron, want error")
+	}
+}
+
+func TestSchedule_LastStop(t *testing.T) {
+	schedule, err := ParseSchedule(map[string]string{
+		UPTIME_LABEL + "-1": "10-11_x_x_x",
+		UPTIME_LABEL + "-2": "12-13_x_x_x",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(hour, min int) time.Time { return time.Date(2020, 4, 15, hour, min, 0, 0, time.UTC) }
+	tests := []struct {
+		from, to time.Time
+		want     time.Time
+	}{
+		{from: at(9, 0), to: at(14, 0), want: at(13, 0)},
+		{from: at(9, 0), to: at(12, 30), want: at(11, 0)},
+		{from: at(11, 0), to: at(12, 30)},
+		{from: at(13, 30), to: at(14, 0)},
+	}
+	for _, tt := range tests {
+		if got := schedule.LastStop(tt.from, tt.to); !got.Equal(tt.want) {
+			t.Errorf("LastStop(%s, %s) = %v, want %v", tt.from.Format("15:04"), tt.to.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestSchedule_NextTransition(t *testing.T) {
+	// Mon-Fri 8-20 and Fri 18-23: on Friday cluster goes down at 23:00
+	schedule, err := ParseSchedule(map[string]string{
+		UPTIME_LABEL + "-1": "8-20_1-6_x_x",
+		UPTIME_LABEL + "-2": "18-23_5-6_x_x",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, status := schedule.NextTransition(time.Date(2020, 4, 17, 12, 0, 0, 0, time.UTC))
+	want := time.Date(2020, 4, 17, 23, 0, 0, 0, time.UTC)
+	if !got.Equal(want) || status != STATUS_DOWN {
+		t.Errorf("NextTransition() = %v, %q, want %v, %q", got, status, want, STATUS_DOWN)
+	}
+	got, status = schedule.NextTransition(want)
+	want = time.Date(2020, 4, 20, 8, 0, 0, 0, time.UTC)
+	if !got.Equal(want) || status != STATUS_UP {
+		t.Errorf("NextTransition() = %v, %q, want %v, %q", got, status, want, STATUS_UP)
+	}
+}
@@ -4,9 +4,13 @@ import "context"
 
 const (
 	// cluster scheduler labels
-	ENABLED_LABEL = "cs-enabled"
-	UPTIME_LABEL  = "cs-uptime"
-	STATUS_LABEL  = "cs-status"
+	ENABLED_LABEL    = "cs-enabled"
+	UPTIME_LABEL     = "cs-uptime"
+	TIMEZONE_LABEL   = "cs-timezone"
+	START_CRON_LABEL = "cs-start-cron"
+	STOP_CRON_LABEL  = "cs-stop-cron"
+	CALENDAR_LABEL   = "cs-calendar"
+	STATUS_LABEL     = "cs-status"
 	// cluster scheduler status values
 	STATUS_DOWN = "down"
 	STATUS_UP   = "up"
@@ -18,6 +22,16 @@ type NodeGroup struct {
 	MinNodeCount int32
 	MaxNodeCount int32
 	Autoscaling  bool
+	// current node count per zone
+	Zones map[string]int32
+	// instance group per zone (GKE managed instance group URL)
+	InstanceGroups map[string]string
+	// stop policy, from 'cs-keep-<node group>' label
+	Stop StopPolicy
+	// own uptime schedule, from node group labels (tags); nil if node group follows cluster schedule
+	Schedule *Schedule
+	// status of node group with own schedule, from 'cs-status-<node group>' label
+	Status string
 }
 
 type Cluster struct {
@@ -25,16 +39,34 @@ type Cluster struct {
 	Location string //region or zone
 	Project  string
 	Status   string
-	Uptime   UptimeRange
+	Schedule Schedule
 	Nodes    []NodeGroup
+	// Kubernetes API server endpoint (host or URL) and cluster CA certificate (PEM)
+	Endpoint string
+	CACert   []byte
 	// GKE specific
 	Labels      map[string]string
 	Fingerprint string
+	// EKS specific
+	ARN string
+	// Err is an error reading cluster schedule or node groups: cluster is not stopped or restarted,
+	// but reported as failed, without stopping processing of other clusters
+	Err error
+	// status labels of node groups with own schedule, but no own status, left out of node groups
+	// transition: their status follows cluster status, so it is kept when cluster status changes
+	pinned map[string]string
 }
 
 type Runner interface {
 	List(context.Context) ([]Cluster, error)
 	Stop(context.Context, Cluster) error
 	Restart(context.Context, Cluster) error
-	DecideOnStatus(Cluster) error
+	// PlanStop returns operations Stop would execute, without calling any mutating API
+	PlanStop(context.Context, Cluster) (*Plan, error)
+	// PlanRestart returns operations Restart would execute, without calling any mutating API
+	PlanRestart(context.Context, Cluster) (*Plan, error)
+	// Restore restarts cluster to backup snapshot (the latest one for empty snapshot), even if cluster is running
+	Restore(ctx context.Context, cluster Cluster, snapshot string) error
+	// PlanRestore returns operations Restore would execute, without calling any mutating API
+	PlanRestore(ctx context.Context, cluster Cluster, snapshot string) (*Plan, error)
 }
@@ -0,0 +1,317 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// backup snapshot id format: backup time in UTC
+	snapshot_FORMAT = "20060102-150405"
+	snapshot_EXT    = ".json"
+)
+
+// ErrBackupNotFound is returned when backup store has no backup for cluster
+var ErrBackupNotFound = errors.New("backup not found")
+
+// ClusterBackup is a backup snapshot of cluster node groups configuration, taken on stop
+type ClusterBackup struct {
+	Cluster    string                      `json:"cluster"`
+	Time       time.Time                   `json:"time"`
+	NodeGroups map[string]*NodeGroupBackup `json:"nodeGroups"`
+}
+
+// NewClusterBackup returns backup of cluster node groups configuration at time t
+func NewClusterBackup(cluster Cluster, t time.Time) *ClusterBackup {
+	backup := &ClusterBackup{
+		Cluster:    cluster.ID(),
+		Time:       t.UTC().Truncate(time.Second),
+		NodeGroups: make(map[string]*NodeGroupBackup, len(cluster.Nodes)),
+	}
+	for _, ng := range cluster.Nodes {
+		// skipped node group is left running: nothing to restore
+		if ng.Stop.Skip {
+			continue
+		}
+		backup.NodeGroups[ng.Name] = NewBackup(ng, t)
+	}
+	return backup
+}
+
+// Snapshot returns backup snapshot id: backup time formatted as 'YYYYMMDD-hhmmss' (UTC)
+func (b *ClusterBackup) Snapshot() string {
+	return b.Time.UTC().Format(snapshot_FORMAT)
+}
+
+// NodeGroup returns node group configuration to restore
+func (b *ClusterBackup) NodeGroup(name string) (*NodeGroup, error) {
+	ng, ok := b.NodeGroups[name]
+	if !ok {
+		return nil, errors.Errorf("no backup of node group %s in snapshot %s", name, b.Snapshot())
+	}
+	return ng.NodeGroup(name), nil
+}
+
+// BackupStore keeps node group backup snapshots of stopped clusters
+type BackupStore interface {
+	// Labels returns cluster labels (tags) storing backup; nil if backup is stored outside the cluster
+	Labels(*ClusterBackup) (map[string]string, error)
+	// Save appends backup snapshot to the store outside the cluster
+	Save(context.Context, *ClusterBackup) error
+	// List returns cluster backup snapshots, the oldest first
+	List(context.Context, Cluster) ([]*ClusterBackup, error)
+}
+
+// PlanBackup plans cluster backup: returns labels to set on cluster (with the status label)
+// or adds backup operation for store keeping backups outside the cluster
+func PlanBackup(plan *Plan, store BackupStore, t time.Time) (map[string]string, error) {
+	backup := NewClusterBackup(plan.Cluster, t)
+	labels, err := store.Labels(backup)
+	if err != nil {
+		return nil, err
+	}
+	if labels == nil {
+		plan.Add(Operation{Type: OP_SAVE_BACKUP, Backup: backup})
+		labels = map[string]string{}
+	}
+	return labels, nil
+}
+
+// LoadBackup returns cluster backup snapshot by id; for empty id, returns the latest backup of each node group,
+// as node groups with own schedule are stopped (and backed up) separately
+func LoadBackup(ctx context.Context, store BackupStore, cluster Cluster, snapshot string) (*ClusterBackup, error) {
+	backups, err := store.List(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) == 0 {
+		return nil, ErrBackupNotFound
+	}
+	if snapshot == "" {
+		latest := &ClusterBackup{Cluster: cluster.ID(), NodeGroups: map[string]*NodeGroupBackup{}}
+		for _, b := range backups {
+			for name, ng := range b.NodeGroups {
+				latest.NodeGroups[name] = ng
+			}
+			latest.Time = b.Time
+		}
+		return latest, nil
+	}
+	for _, b := range backups {
+		if b.Snapshot() == snapshot {
+			return b, nil
+		}
+	}
+	return nil, errors.Wrapf(ErrBackupNotFound, "snapshot %s", snapshot)
+}
+
+// sortBackups sorts backup snapshots by time, the oldest first
+func sortBackups(backups []*ClusterBackup) {
+	sort.SliceStable(backups, func(i, j int) bool { return backups[i].Time.Before(backups[j].Time) })
+}
+
+// LabelStore keeps backups in cluster labels (GKE) or tags (EKS); only the latest snapshot is kept
+type LabelStore struct{}
+
+func (LabelStore) Labels(backup *ClusterBackup) (map[string]string, error) {
+	labels := make(map[string]string, len(backup.NodeGroups))
+	for name, ng := range backup.NodeGroups {
+		value, err := BackupLabel(ng)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to backup node group %s", name)
+		}
+		labels[GetBackupLabel(name)] = value
+	}
+	return labels, nil
+}
+
+// Save does nothing: labels are set by Runner together with the cluster status label
+func (LabelStore) Save(context.Context, *ClusterBackup) error {
+	return nil
+}
+
+func (LabelStore) List(_ context.Context, cluster Cluster) ([]*ClusterBackup, error) {
+	backup := &ClusterBackup{Cluster: cluster.ID(), NodeGroups: make(map[string]*NodeGroupBackup, len(cluster.Nodes))}
+	for _, ng := range cluster.Nodes {
+		if _, ok := cluster.Labels[GetBackupLabel(ng.Name)]; !ok {
+			continue
+		}
+		b, err := ParseBackupLabels(ng.Name, cluster.Labels)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read backup from label")
+		}
+		b.Zones = zoneNames(b.Zones, ng)
+		backup.NodeGroups[ng.Name] = b
+		if b.Time.After(backup.Time) {
+			backup.Time = b.Time
+		}
+	}
+	if len(backup.NodeGroups) == 0 {
+		return nil, nil
+	}
+	return []*ClusterBackup{backup}, nil
+}
+
+// zoneNames returns node count per zone with full zone names of node group zones ('b' is 'europe-west1-b');
+// zones node group has no instance group in anymore are kept as is
+func zoneNames(zones map[string]int32, ng NodeGroup) map[string]int32 {
+	if zones == nil {
+		return nil
+	}
+	result := make(map[string]int32, len(zones))
+	for zone, count := range zones {
+		for current := range ng.InstanceGroups {
+			if zoneSuffix(current) == zone {
+				zone = current
+				break
+			}
+		}
+		result[zone] = count
+	}
+	return result
+}
+
+// FileStore keeps backup snapshots as JSON files in local directory: <dir>/<project>/<location>/<cluster>/<snapshot>.json
+type FileStore struct {
+	Dir string
+}
+
+func (s FileStore) path(cluster string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(cluster))
+}
+
+func (FileStore) Labels(*ClusterBackup) (map[string]string, error) {
+	return nil, nil
+}
+
+func (s FileStore) Save(_ context.Context, backup *ClusterBackup) error {
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal cluster backup")
+	}
+	dir := s.path(backup.Cluster)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "failed to create backup directory")
+	}
+	// write to temporary file and rename, so a partially written snapshot is never listed
+	name := filepath.Join(dir, backup.Snapshot()+snapshot_EXT)
+	tmp := name + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write cluster backup")
+	}
+	return errors.Wrap(os.Rename(tmp, name), "failed to write cluster backup")
+}
+
+func (s FileStore) List(_ context.Context, cluster Cluster) ([]*ClusterBackup, error) {
+	dir := s.path(cluster.ID())
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list cluster backups")
+	}
+	var backups []*ClusterBackup
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), snapshot_EXT) {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read cluster backup")
+		}
+		backup, err := unmarshalBackup(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid backup file %s", f.Name())
+		}
+		backups = append(backups, backup)
+	}
+	sortBackups(backups)
+	return backups, nil
+}
+
+// ObjectClient reads and writes objects of a storage bucket (GCS, S3)
+type ObjectClient interface {
+	// Put creates or overwrites object
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns object data; ErrObjectNotFound if object does not exist
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns keys of objects with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// ErrObjectNotFound is returned by ObjectClient for missing object
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore keeps backup snapshots as JSON objects in storage bucket: <prefix>/<project>/<location>/<cluster>/<snapshot>.json
+type ObjectStore struct {
+	Client ObjectClient
+	Prefix string
+}
+
+func (s ObjectStore) key(cluster string) string {
+	return path.Join(s.Prefix, cluster) + "/"
+}
+
+func (ObjectStore) Labels(*ClusterBackup) (map[string]string, error) {
+	return nil, nil
+}
+
+func (s ObjectStore) Save(ctx context.Context, backup *ClusterBackup) error {
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal cluster backup")
+	}
+	key := s.key(backup.Cluster) + backup.Snapshot() + snapshot_EXT
+	return errors.Wrap(s.Client.Put(ctx, key, data), "failed to write cluster backup")
+}
+
+func (s ObjectStore) List(ctx context.Context, cluster Cluster) ([]*ClusterBackup, error) {
+	keys, err := s.Client.List(ctx, s.key(cluster.ID()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list cluster backups")
+	}
+	var backups []*ClusterBackup
+	for _, key := range keys {
+		if !strings.HasSuffix(key, snapshot_EXT) {
+			continue
+		}
+		data, err := s.Client.Get(ctx, key)
+		if err == ErrObjectNotFound {
+			// deleted after listing
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read cluster backup")
+		}
+		backup, err := unmarshalBackup(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid backup object %s", key)
+		}
+		backups = append(backups, backup)
+	}
+	sortBackups(backups)
+	return backups, nil
+}
+
+func unmarshalBackup(data []byte) (*ClusterBackup, error) {
+	var backup ClusterBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal cluster backup")
+	}
+	for name, ng := range backup.NodeGroups {
+		if ng.Version > BACKUP_VERSION {
+			return nil, errors.Errorf("unsupported backup version %d of node group %s", ng.Version, name)
+		}
+	}
+	return &backup, nil
+}
@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// memoryObjects is an in-memory ObjectClient
+type memoryObjects struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memoryObjects) Put(_ context.Context, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+	return nil
+}
+
+func (m *memoryObjects) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return data, nil
+}
+
+func (m *memoryObjects) List(_ context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func TestBackupStore(t *testing.T) {
+	now := time.Date(2020, 4, 15, 22, 0, 0, 0, time.UTC)
+	nodes := []NodeGroup{
+		{Name: "default", NodeCount: 2},
+		{Name: "very-long-node-pool-name-for-batch-processing-jobs", NodeCount: 3, MinNodeCount: 1, MaxNodeCount: 5, Autoscaling: true},
+	}
+	tests := []struct {
+		name  string
+		store BackupStore
+	}{
+		{name: "labels", store: LabelStore{}},
+		{name: "file", store: FileStore{Dir: t.TempDir()}},
+		{name: "object", store: ObjectStore{Client: &memoryObjects{objects: map[string][]byte{}}, Prefix: "backups"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cluster := Cluster{Project: "demo", Location: "us-central1", Name: "dev", Nodes: nodes, Labels: map[string]string{}}
+			plan := &Plan{Cluster: cluster, Status: STATUS_DOWN}
+			labels, err := PlanBackup(plan, tt.store, now)
+			if err != nil {
+				t.Fatalf("PlanBackup() error = %v", err)
+			}
+			if _, inLabels := tt.store.(LabelStore); inLabels == (len(plan.Operations) != 0) {
+				t.Fatalf("PlanBackup() operations = %v", plan.Operations)
+			}
+			if _, err = LoadBackup(ctx, tt.store, cluster, ""); err != ErrBackupNotFound {
+				t.Fatalf("LoadBackup() before backup error = %v, want %v", err, ErrBackupNotFound)
+			}
+			// execute plan: save backup or set labels
+			for _, op := range plan.Operations {
+				if op.Type != OP_SAVE_BACKUP {
+					t.Fatalf("PlanBackup() operation = %v, want %s", op, OP_SAVE_BACKUP)
+				}
+				if err = tt.store.Save(ctx, op.Backup); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+			cluster.Labels = labels
+			backup, err := LoadBackup(ctx, tt.store, cluster, "")
+			if err != nil {
+				t.Fatalf("LoadBackup() error = %v", err)
+			}
+			if backup.Cluster != cluster.ID() || !backup.Time.Equal(now) || backup.Snapshot() != "20200415-220000" {
+				t.Errorf("LoadBackup() cluster = %s, time = %v, snapshot = %s", backup.Cluster, backup.Time, backup.Snapshot())
+			}
+			for _, ng := range nodes {
+				if got, err := backup.NodeGroup(ng.Name); err != nil || !reflect.DeepEqual(*got, ng) {
+					t.Errorf("NodeGroup() = %+v (error %v), want %+v", got, err, ng)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupStore_History(t *testing.T) {
+	tests := []struct {
+		name  string
+		store BackupStore
+	}{
+		{name: "file", store: FileStore{Dir: t.TempDir()}},
+		{name: "object", store: ObjectStore{Client: &memoryObjects{objects: map[string][]byte{}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cluster := Cluster{Project: "demo", Location: "us-central1", Name: "dev"}
+			// the same cluster stopped twice: the second backup must not overwrite the first one
+			for i, count := range []int32{3, 0} {
+				cluster.Nodes = []NodeGroup{{Name: "pool", NodeCount: count}}
+				if err := tt.store.Save(ctx, NewClusterBackup(cluster, time.Date(2020, 4, 15+i, 22, 0, 0, 0, time.UTC))); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+			backups, err := tt.store.List(ctx, cluster)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			var snapshots []string
+			for _, b := range backups {
+				snapshots = append(snapshots, b.Snapshot())
+			}
+			if want := []string{"20200415-220000", "20200416-220000"}; !reflect.DeepEqual(snapshots, want) {
+				t.Errorf("List() snapshots = %v, want %v", snapshots, want)
+			}
+			backup, err := LoadBackup(ctx, tt.store, cluster, "20200415-220000")
+			if err != nil {
+				t.Fatalf("LoadBackup() error = %v", err)
+			}
+			if got, _ := backup.NodeGroup("pool"); got.NodeCount != 3 {
+				t.Errorf("LoadBackup() node count = %d, want 3", got.NodeCount)
+			}
+			if _, err = LoadBackup(ctx, tt.store, cluster, "20200101-000000"); !errors.Is(err, ErrBackupNotFound) {
+				t.Errorf("LoadBackup() unknown snapshot error = %v, want %v", err, ErrBackupNotFound)
+			}
+			// node group with own schedule stopped separately: the latest backup of each node group is loaded
+			cluster.Nodes = []NodeGroup{{Name: "batch", NodeCount: 4}}
+			if err = tt.store.Save(ctx, NewClusterBackup(cluster, time.Date(2020, 4, 17, 6, 0, 0, 0, time.UTC))); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if backup, err = LoadBackup(ctx, tt.store, cluster, ""); err != nil {
+				t.Fatalf("LoadBackup() latest error = %v", err)
+			}
+			pool, _ := backup.NodeGroup("pool")
+			batch, _ := backup.NodeGroup("batch")
+			if pool == nil || pool.NodeCount != 0 || batch == nil || batch.NodeCount != 4 || backup.Snapshot() != "20200417-060000" {
+				t.Errorf("LoadBackup() latest = %+v, want pool and batch node groups", backup)
+			}
+		})
+	}
+}
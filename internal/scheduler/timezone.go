@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"strings"
+	"time"
+	// embed IANA time zone database: the release image is built from scratch
+	_ "time/tzdata"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// time zone label-safe separator; GKE label values cannot contain '/'
+	tz_SEPARATOR = "--"
+)
+
+// lowercase particles found inside IANA time zone names, like Port-au-Prince or Dar_es_Salaam
+var tzParticles = map[string]bool{"au": true, "es": true, "of": true}
+
+// ParseTimezone loads time zone location from 'cs-timezone' label value
+//
+// Both IANA names (Europe/Berlin) and label-safe names (europe--berlin) are supported:
+// GKE label values must be lowercase and cannot contain '/', so '/' is written as '--'
+// and the original case is restored. Empty value means UTC.
+func ParseTimezone(spec string) (*time.Location, error) {
+	if spec == "" {
+		return time.UTC, nil
+	}
+	name := strings.ReplaceAll(spec, tz_SEPARATOR, "/")
+	for _, candidate := range tzCandidates(name) {
+		if loc, err := time.LoadLocation(candidate); err == nil {
+			return loc, nil
+		}
+	}
+	return nil, errors.Errorf("unknown time zone '%s'", spec)
+}
+
+// tzCandidates returns possible IANA time zone names for case-insensitive name
+func tzCandidates(name string) []string {
+	// title case: america/port-au-prince -> America/Port-au-Prince
+	var title strings.Builder
+	word := 0
+	for i, r := range name {
+		if r == '/' || r == '_' || r == '-' {
+			title.WriteRune(r)
+			word = i + 1
+			continue
+		}
+		if i == word && !isParticle(name[i:]) {
+			title.WriteString(strings.ToUpper(string(r)))
+		} else {
+			title.WriteRune(r)
+		}
+	}
+	// upper case abbreviations: etc/utc -> Etc/UTC, est5edt -> EST5EDT
+	abbr := strings.ToUpper(name)
+	if i := strings.Index(name, "/"); i >= 0 {
+		abbr = title.String()[:i] + strings.ToUpper(name[i:])
+	}
+	return []string{name, title.String(), abbr}
+}
+
+func isParticle(s string) bool {
+	end := strings.IndexAny(s, "/_-")
+	if end < 0 {
+		return false
+	}
+	return tzParticles[s[:end]]
+}
@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimezone(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "", want: "UTC"},
+		{spec: "Europe/Berlin", want: "Europe/Berlin"},
+		{spec: "europe--berlin", want: "Europe/Berlin"},
+		{spec: "america--new_york", want: "America/New_York"},
+		{spec: "america--port-au-prince", want: "America/Port-au-Prince"},
+		{spec: "america--argentina--buenos_aires", want: "America/Argentina/Buenos_Aires"},
+		{spec: "etc--utc", want: "Etc/UTC"},
+		{spec: "est5edt", want: "EST5EDT"},
+		{spec: "mars--olympus_mons", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseTimezone(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimezone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("ParseTimezone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUptimeRange_IsInRangeTimezone(t *testing.T) {
+	berlin, err := ParseTimezone("europe--berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uptime, err := ParseUptime("8-19_1-6_x_x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uptime.Location = berlin
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		// 07:30 UTC is 08:30 CET in winter
+		{name: "winter office hours", t: time.Date(2020, 1, 15, 7, 30, 0, 0, time.UTC), want: true},
+		// 18:30 UTC is 20:30 CEST in summer
+		{name: "summer after hours", t: time.Date(2020, 7, 15, 18, 30, 0, 0, time.UTC), want: false},
+		// 17:30 UTC is 18:30 CET in winter
+		{name: "winter before close", t: time.Date(2020, 1, 15, 17, 30, 0, 0, time.UTC), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uptime.IsInRange(tt.t); got != tt.want {
+				t.Errorf("IsInRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
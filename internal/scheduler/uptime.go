@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -8,22 +9,31 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	// how far to look for uptime range transition: leap day is checked once in 4 years
+	uptime_SEARCH_DAYS = 4*366 + 1
+)
+
 type Range struct {
 	From int
 	To   int
 }
 
 type UptimeRange struct {
-	Hours    Range
+	// time of day range in minutes since midnight
+	Minutes  Range
 	Days     Range
 	Months   Range
 	Weekdays Range
+	// time zone to check ranges in; time location is used when nil
+	Location *time.Location
 }
 
 func parseRange(spec string, min, max int) (*Range, error) {
-	// 'x' - full range
+	// 'x' - full range: 'to' is excluded, so it is one past max; Range{min, max} used to leave out
+	// the last value (Saturday, day 31, December)
 	if spec == "x" {
-		return &Range{min, max}, nil
+		return &Range{min, max + 1}, nil
 	}
 	// split range
 	r := strings.Split(spec, "-")
@@ -51,14 +61,69 @@ func parseRange(spec string, min, max int) (*Range, error) {
 	return &Range{from, to}, nil
 }
 
+// parseTimeOfDay parses 'HH' or label-safe 'HHMM' time of day into minutes since midnight
+func parseTimeOfDay(spec string) (int, error) {
+	if len(spec) != 4 {
+		hour, err := strconv.Atoi(spec)
+		if err != nil {
+			return 0, err
+		}
+		if hour < 0 || hour > 24 {
+			return 0, errors.New("hour out of allowed range: 0-24")
+		}
+		return hour * 60, nil
+	}
+	hour, err := strconv.Atoi(spec[:2])
+	if err != nil {
+		return 0, err
+	}
+	minute, err := strconv.Atoi(spec[2:])
+	if err != nil {
+		return 0, err
+	}
+	if minute < 0 || minute > 59 {
+		return 0, errors.New("minute out of allowed range: 00-59")
+	}
+	if hour < 0 || hour > 24 || hour == 24 && minute > 0 {
+		return 0, errors.New("time out of allowed range: 0000-2400")
+	}
+	return hour*60 + minute, nil
+}
+
+// parseTimeRange parses time of day range: 'from-to' in whole hours (8-19) or HHMM (0730-1845)
+func parseTimeRange(spec string) (*Range, error) {
+	// 'x' - full day
+	if spec == "x" {
+		return &Range{0, 24 * 60}, nil
+	}
+	// split range
+	r := strings.Split(spec, "-")
+	if len(r) != 2 {
+		return nil, errors.New("invalid range, must be of form 'from-to'")
+	}
+	from, err := parseTimeOfDay(r[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "the first element in the range is not valid")
+	}
+	to, err := parseTimeOfDay(r[1])
+	if err != nil {
+		return nil, errors.Wrap(err, "the second element in the range is not valid")
+	}
+	if to == from {
+		return nil, errors.New("'from' cannot be equal to 'to'")
+	}
+
+	return &Range{from, to}, nil
+}
+
 func ParseUptime(spec string) (*UptimeRange, error) {
 	uptime := strings.Split(spec, "_")
 	if len(uptime) != 4 {
 		return nil, errors.New("uptime should contain 4 ranges: hours_weekday_days_months")
 	}
-	hours, err := parseRange(uptime[0], 0, 24)
+	minutes, err := parseTimeRange(uptime[0])
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid hours range, must be between 0-23")
+		return nil, errors.Wrap(err, "invalid hours range, must be between 0-24 or 0000-2400")
 	}
 	weekdays, err := parseRange(uptime[1], 0, 6)
 	if err != nil {
@@ -74,12 +139,42 @@ func ParseUptime(spec string) (*UptimeRange, error) {
 	}
 
 	return &UptimeRange{
-		Hours:    *hours,
+		Minutes:  *minutes,
 		Days:     *days,
 		Months:   *months,
 		Weekdays: *weekdays}, nil
 }
 
+// formatRange formats range in uptime spec form
+func formatRange(r Range, min, max int) string {
+	if r.From == min && r.To == max+1 {
+		return "x"
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// formatTimeOfDay formats minutes since midnight as 'HH' or label-safe 'HHMM'
+func formatTimeOfDay(minutes int) string {
+	if minutes%60 == 0 {
+		return strconv.Itoa(minutes / 60)
+	}
+	return fmt.Sprintf("%02d%02d", minutes/60, minutes%60)
+}
+
+// String returns uptime in 'hours_weekdays_days_months' form
+func (uptime *UptimeRange) String() string {
+	hours := "x"
+	if uptime.Minutes != (Range{0, 24 * 60}) {
+		hours = formatTimeOfDay(uptime.Minutes.From) + "-" + formatTimeOfDay(uptime.Minutes.To)
+	}
+	return strings.Join([]string{
+		hours,
+		formatRange(uptime.Weekdays, 0, 6),
+		formatRange(uptime.Days, 1, 31),
+		formatRange(uptime.Months, 1, 12),
+	}, "_")
+}
+
 func checkRange(v int, r Range) bool {
 	if r.From < r.To {
 		if v < r.From || v >= r.To {
@@ -94,8 +189,12 @@ func checkRange(v int, r Range) bool {
 }
 
 func (uptime *UptimeRange) IsInRange(t time.Time) bool {
-	// check hours range
-	if !checkRange(t.Hour(), uptime.Hours) {
+	// check ranges in uptime time zone
+	if uptime.Location != nil {
+		t = t.In(uptime.Location)
+	}
+	// check time of day range
+	if !checkRange(t.Hour()*60+t.Minute(), uptime.Minutes) {
 		return false
 	}
 	// check days range
@@ -113,3 +212,31 @@ func (uptime *UptimeRange) IsInRange(t time.Time) bool {
 	// in range
 	return true
 }
+
+// NextTransition returns the first time after t when IsInRange result changes, and cluster status after it;
+// empty status means no transition is found (e.g. uptime covers all time).
+// Result can change only at time of day range boundaries or at midnight, when other ranges change.
+func (uptime *UptimeRange) NextTransition(from time.Time) (time.Time, string) {
+	t := from
+	if uptime.Location != nil {
+		t = t.In(uptime.Location)
+	}
+	loc := t.Location()
+	current := uptime.IsInRange(t)
+	// up to 3 candidates per day: time of day range boundaries and midnight
+	for i := 0; i < 3*uptime_SEARCH_DAYS; i++ {
+		y, m, d := t.Date()
+		next := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		for _, minute := range []int{uptime.Minutes.From, uptime.Minutes.To} {
+			b := time.Date(y, m, d, 0, minute, 0, 0, loc)
+			if b.After(t) && b.Before(next) {
+				next = b
+			}
+		}
+		t = next
+		if in := uptime.IsInRange(t); in != current {
+			return t, statusOf(in)
+		}
+	}
+	return time.Time{}, ""
+}
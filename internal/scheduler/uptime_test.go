@@ -1,6 +1,9 @@
 package scheduler
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func Test_checkRange(t *testing.T) {
 	type args struct {
@@ -101,3 +104,156 @@ func Test_checkRange(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseTimeRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    Range
+		wantErr bool
+	}{
+		{name: "full day", spec: "x", want: Range{0, 1440}},
+		{name: "whole hours", spec: "8-19", want: Range{480, 1140}},
+		{name: "hours and minutes", spec: "0730-1845", want: Range{450, 1125}},
+		{name: "mixed", spec: "22-0615", want: Range{1320, 375}},
+		{name: "end of day", spec: "1830-2400", want: Range{1110, 1440}},
+		{name: "invalid minutes", spec: "0760-1800", wantErr: true},
+		{name: "invalid hours", spec: "2530-1800", wantErr: true},
+		{name: "after end of day", spec: "1800-2430", wantErr: true},
+		{name: "equal", spec: "0800-8", wantErr: true},
+		{name: "not a range", spec: "0800", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimeRange(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimeRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("parseTimeRange() = %v, want %v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUptimeRange_IsInRange(t *testing.T) {
+	uptime, err := ParseUptime("0730-1845_1-6_x_x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{name: "before start", t: time.Date(2020, 4, 15, 7, 29, 0, 0, time.UTC), want: false},
+		{name: "at start", t: time.Date(2020, 4, 15, 7, 30, 0, 0, time.UTC), want: true},
+		{name: "before end", t: time.Date(2020, 4, 15, 18, 44, 0, 0, time.UTC), want: true},
+		{name: "at end", t: time.Date(2020, 4, 15, 18, 45, 0, 0, time.UTC), want: false},
+		{name: "weekend", t: time.Date(2020, 4, 18, 10, 0, 0, 0, time.UTC), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uptime.IsInRange(tt.t); got != tt.want {
+				t.Errorf("IsInRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUptime_FullRange(t *testing.T) {
+	uptime, err := ParseUptime("x_x_x_x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last value of each range
+	tests := []struct {
+		name string
+		t    time.Time
+	}{
+		{name: "end of day", t: time.Date(2020, 4, 15, 23, 59, 0, 0, time.UTC)},
+		{name: "Saturday", t: time.Date(2020, 4, 18, 0, 0, 0, 0, time.UTC)},
+		{name: "day 31", t: time.Date(2020, 3, 31, 12, 0, 0, 0, time.UTC)},
+		{name: "December", t: time.Date(2020, 12, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if !uptime.IsInRange(tt.t) {
+			t.Errorf("IsInRange() on %s = false, want true", tt.name)
+		}
+	}
+}
+
+func TestUptimeRange_NextTransition(t *testing.T) {
+	tests := []struct {
+		name       string
+		spec       string
+		from       time.Time
+		want       time.Time
+		wantStatus string
+	}{
+		{
+			name:       "stop in the evening",
+			spec:       "0730-1845_1-6_x_x",
+			from:       time.Date(2020, 4, 15, 10, 0, 0, 0, time.UTC),
+			want:       time.Date(2020, 4, 15, 18, 45, 0, 0, time.UTC),
+			wantStatus: STATUS_DOWN,
+		},
+		{
+			name:       "start in the morning",
+			spec:       "0730-1845_1-6_x_x",
+			from:       time.Date(2020, 4, 15, 20, 0, 0, 0, time.UTC),
+			want:       time.Date(2020, 4, 16, 7, 30, 0, 0, time.UTC),
+			wantStatus: STATUS_UP,
+		},
+		{
+			name:       "start after weekend",
+			spec:       "0730-1845_1-6_x_x",
+			from:       time.Date(2020, 4, 17, 19, 0, 0, 0, time.UTC),
+			want:       time.Date(2020, 4, 20, 7, 30, 0, 0, time.UTC),
+			wantStatus: STATUS_UP,
+		},
+		{
+			name:       "wrap-around hours",
+			spec:       "22-6_x_x_x",
+			from:       time.Date(2020, 4, 15, 23, 0, 0, 0, time.UTC),
+			want:       time.Date(2020, 4, 16, 6, 0, 0, 0, time.UTC),
+			wantStatus: STATUS_DOWN,
+		},
+		{
+			name:       "wrap-around weekdays",
+			spec:       "x_6-1_x_x",
+			from:       time.Date(2020, 4, 15, 12, 0, 0, 0, time.UTC),
+			want:       time.Date(2020, 4, 18, 0, 0, 0, 0, time.UTC),
+			wantStatus: STATUS_UP,
+		},
+		{
+			name: "always up",
+			spec: "x_x_x_x",
+			from: time.Date(2020, 4, 15, 12, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uptime, err := ParseUptime(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, status := uptime.NextTransition(tt.from)
+			if !got.Equal(tt.want) || status != tt.wantStatus {
+				t.Errorf("NextTransition() = %v, %q, want %v, %q", got, status, tt.want, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestUptimeRange_String(t *testing.T) {
+	for _, spec := range []string{"8-19_1-6_x_x", "0730-1845_6-1_1-15_x", "x_x_x_10-4"} {
+		uptime, err := ParseUptime(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := uptime.String(); got != spec {
+			t.Errorf("String() = %q, want %q", got, spec)
+		}
+	}
+}
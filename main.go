@@ -4,11 +4,16 @@ import (
 	"context"
 	"fmt"
 	"github.com/doitintl/cluster-scheduler/internal/scheduler"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/doitintl/cluster-scheduler/internal/output"
 	"github.com/doitintl/cluster-scheduler/internal/scheduler/aws"
 	"github.com/doitintl/cluster-scheduler/internal/scheduler/gke"
 	"github.com/pkg/errors"
@@ -17,11 +22,18 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// exit code when some clusters failed to stop, restart or reconcile
+	exit_CLUSTERS_FAILED = 2
+)
+
 var (
 	// main context
 	mainCtx context.Context
 	// cluster scheduler runner
 	runner scheduler.Runner
+	// node groups backup store
+	store scheduler.BackupStore
 	// Version contains the current version.
 	Version = "dev"
 	// BuildDate contains a string with the build date.
@@ -60,64 +72,333 @@ func before(c *cli.Context) error {
 	if c.Bool("json") {
 		log.SetFormatter(&log.JSONFormatter{})
 	}
-	// set default scheduler runner
+	// load calendars
+	var calendars scheduler.Calendars
 	var err error
+	if dir := c.String("calendars"); dir != "" {
+		if calendars, err = scheduler.LoadCalendars(dir); err != nil {
+			return errors.Wrap(err, "failed to load calendars")
+		}
+	}
+	// create node groups backup store
+	store, err = backupStore(mainCtx, c.String("backup-store"))
+	if err != nil {
+		return errors.Wrap(err, "failed to create backup store")
+	}
+	// drain node groups before stop
+	var drain time.Duration
+	if c.Bool("drain") {
+		drain = c.Duration("drain-timeout")
+	}
+	// set default scheduler runner
 	switch cluster := c.String("cluster"); cluster {
 	case "gke":
-		runner, err = gke.NewGkeScheduler(mainCtx)
+		runner, err = gke.NewGkeScheduler(mainCtx, gke.WithBackupStore(store), gke.WithCalendars(calendars), gke.WithDrain(drain))
 	case "eks":
-		runner, err = aws.NewEksScheduler(mainCtx)
+		runner, err = aws.NewEksScheduler(mainCtx, aws.WithBackupStore(store), aws.WithCalendars(calendars), aws.WithDrain(drain))
 	default:
-		runner, err = gke.NewGkeScheduler(mainCtx)
+		runner, err = gke.NewGkeScheduler(mainCtx, gke.WithBackupStore(store), gke.WithCalendars(calendars), gke.WithDrain(drain))
 	}
 
 	return err
 }
 
-func listCmd(c *cli.Context) error {
-	log.Debug("list clusters")
-	clusters, err := runner.List(mainCtx)
+// backupStore creates backup store from location: 'labels', 'file://<dir>', 'gs://<bucket>/<prefix>' or 's3://<bucket>/<prefix>'
+func backupStore(ctx context.Context, location string) (scheduler.BackupStore, error) {
+	if location == "" || location == "labels" {
+		return scheduler.LabelStore{}, nil
+	}
+	u, err := url.Parse(location)
 	if err != nil {
-		return errors.Wrap(err, "failed list clusters")
+		return nil, errors.Wrapf(err, "invalid backup store location '%s'", location)
 	}
-	for _, c := range clusters {
-		//log.WithFields()
-		err := runner.DecideOnStatus(c)
+	prefix := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "file":
+		return scheduler.FileStore{Dir: filepath.FromSlash(u.Host + u.Path)}, nil
+	case "gs":
+		client, err := gke.NewStorageClient(ctx, u.Host)
 		if err != nil {
-			return errors.Wrap(err, "failed to decide on next cluster status")
+			return nil, err
 		}
+		return scheduler.ObjectStore{Client: client, Prefix: prefix}, nil
+	case "s3":
+		client, err := aws.NewS3Client(u.Host)
+		if err != nil {
+			return nil, err
+		}
+		return scheduler.ObjectStore{Client: client, Prefix: prefix}, nil
 	}
-	return nil
+	return nil, errors.Errorf("unsupported backup store location '%s'", location)
 }
 
-func stopCmd(c *cli.Context) error {
-	clusters, err := runner.List(mainCtx)
+// cluster filter flags for commands acting on clusters
+var filterFlags = []cli.Flag{
+	&cli.StringSliceFlag{
+		Name:  "name",
+		Usage: "select clusters by name (supports shell patterns, e.g. 'sandbox-*')",
+	},
+	&cli.StringSliceFlag{
+		Name:  "location",
+		Usage: "select clusters by location (region or zone)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "project",
+		Usage: "select clusters by project (project ID on GKE)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "selector",
+		Usage: "select clusters by label (key=value)",
+	},
+}
+
+func clusterFilter(c *cli.Context) (*scheduler.Filter, error) {
+	selector, err := scheduler.ParseSelector(c.StringSlice("selector"))
 	if err != nil {
-		return errors.Wrap(err, "failed list clusters")
+		return nil, err
 	}
-	log.Debug("stopping clusters")
-	for _, c := range clusters {
-		err := runner.Stop(mainCtx, c)
-		if err != nil {
-			return errors.Wrap(err, "failed to stop cluster")
+	return &scheduler.Filter{
+		Names:     c.StringSlice("name"),
+		Locations: c.StringSlice("location"),
+		Projects:  c.StringSlice("project"),
+		Selector:  selector,
+	}, nil
+}
+
+// dry-run flag for commands changing clusters
+var dryRunFlag = &cli.BoolFlag{
+	Name:  "dry-run",
+	Usage: "print planned operations (label changes, node pool sizes) without changing clusters",
+}
+
+// concurrency flag for commands changing clusters
+var concurrencyFlag = &cli.IntFlag{
+	Name:  "concurrency",
+	Usage: "max number of clusters processed in parallel; node pools of the same cluster are processed one by one",
+	Value: 4,
+}
+
+// output format flag for list commands
+var outputFlag = &cli.StringFlag{
+	Name:    "output",
+	Aliases: []string{"o"},
+	Usage:   "output format (table(*), json, yaml)",
+	Value:   output.FORMAT_TABLE,
+}
+
+// fail-fast flag for commands changing clusters
+var failFastFlag = &cli.BoolFlag{
+	Name:  "fail-fast",
+	Usage: "stop processing remaining clusters after the first cluster error",
+}
+
+func runOptions(c *cli.Context) scheduler.RunOptions {
+	return scheduler.RunOptions{
+		Concurrency: c.Int("concurrency"),
+		FailFast:    c.Bool("fail-fast"),
+	}
+}
+
+// protected workloads flags of reconcile commands
+var protectFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "protect-workloads",
+		Usage: "postpone scheduled stop while Jobs or pods annotated 'cluster-scheduler/keep-alive=true' are running",
+	},
+	&cli.DurationFlag{
+		Name:  "max-stop-delay",
+		Usage: "max time scheduled stop is postponed due to protected workloads",
+		Value: 4 * time.Hour,
+	},
+}
+
+func reconcileOptions(c *cli.Context) (scheduler.ReconcileOptions, error) {
+	opts := scheduler.ReconcileOptions{RunOptions: runOptions(c), MaxStopDelay: c.Duration("max-stop-delay")}
+	if c.Bool("protect-workloads") {
+		guard, ok := runner.(scheduler.StopGuard)
+		if !ok {
+			return opts, errors.New("protected workloads check is not supported by cluster type")
 		}
+		opts.Guard = guard
+	}
+	return opts, nil
+}
+
+// writeSummary prints clusters processing summary to stderr, keeping stdout for dry-run plans
+func writeSummary(action string, summary *scheduler.Summary) {
+	if summary == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", action)
+	_ = summary.Write(os.Stderr)
+}
+
+// clusterRunner returns runner that prints planned operations in dry-run mode
+func clusterRunner(c *cli.Context) scheduler.Runner {
+	if c.Bool("dry-run") {
+		return &scheduler.DryRunner{Runner: runner, Out: os.Stdout}
+	}
+	return runner
+}
+
+func listClusters(ctx context.Context, filter *scheduler.Filter) ([]scheduler.Cluster, error) {
+	clusters, err := scheduler.ListClusters(ctx, runner, filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed list clusters")
 	}
-	return nil
+	return clusters, nil
+}
+
+func listCmd(c *cli.Context) error {
+	log.Debug("list clusters")
+	filter, err := clusterFilter(c)
+	if err != nil {
+		return err
+	}
+	clusters, err := listClusters(mainCtx, filter)
+	if err != nil {
+		return err
+	}
+	return output.WriteClusters(os.Stdout, c.String("output"), clusters, time.Now())
+}
+
+func stopCmd(c *cli.Context) error {
+	filter, err := clusterFilter(c)
+	if err != nil {
+		return err
+	}
+	clusters, err := listClusters(mainCtx, filter)
+	if err != nil {
+		return err
+	}
+	r := clusterRunner(c)
+	log.Debug("stopping clusters")
+	summary, err := scheduler.Run(mainCtx, clusters, runOptions(c), func(ctx context.Context, cluster scheduler.Cluster) error {
+		return errors.Wrap(r.Stop(ctx, cluster), "failed to stop cluster")
+	})
+	writeSummary("stop", summary)
+	return err
 }
 
 func restartCmd(c *cli.Context) error {
-	clusters, err := runner.List(mainCtx)
+	filter, err := clusterFilter(c)
+	if err != nil {
+		return err
+	}
+	clusters, err := listClusters(mainCtx, filter)
 	if err != nil {
-		return errors.Wrap(err, "failed list clusters")
+		return err
 	}
+	r := clusterRunner(c)
 	log.Debug("restarting clusters")
-	for _, c := range clusters {
-		err := runner.Restart(mainCtx, c)
+	summary, err := scheduler.Run(mainCtx, clusters, runOptions(c), func(ctx context.Context, cluster scheduler.Cluster) error {
+		return errors.Wrap(r.Restart(ctx, cluster), "failed to restart cluster")
+	})
+	writeSummary("restart", summary)
+	return err
+}
+
+func restoreCmd(c *cli.Context) error {
+	filter, err := clusterFilter(c)
+	if err != nil {
+		return err
+	}
+	clusters, err := listClusters(mainCtx, filter)
+	if err != nil {
+		return err
+	}
+	r := clusterRunner(c)
+	snapshot := c.String("snapshot")
+	log.WithField("snapshot", snapshot).Debug("restoring clusters")
+	summary, err := scheduler.Run(mainCtx, clusters, runOptions(c), func(ctx context.Context, cluster scheduler.Cluster) error {
+		return errors.Wrap(r.Restore(ctx, cluster, snapshot), "failed to restore cluster")
+	})
+	writeSummary("restore", summary)
+	return err
+}
+
+func backupListCmd(c *cli.Context) error {
+	filter, err := clusterFilter(c)
+	if err != nil {
+		return err
+	}
+	clusters, err := listClusters(mainCtx, filter)
+	if err != nil {
+		return err
+	}
+	log.Debug("list backups")
+	var backups []*scheduler.ClusterBackup
+	for _, cluster := range clusters {
+		b, err := store.List(mainCtx, cluster)
 		if err != nil {
-			return errors.Wrap(err, "failed to restart cluster")
+			return errors.Wrapf(err, "failed to list backups of cluster %s", cluster.ID())
+		}
+		backups = append(backups, b...)
+	}
+	return output.WriteBackups(os.Stdout, c.String("output"), backups)
+}
+
+func reconcile(ctx context.Context, r scheduler.Runner, filter *scheduler.Filter, opts scheduler.ReconcileOptions) ([]scheduler.Cluster, *scheduler.Summary, error) {
+	clusters, err := listClusters(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Debug("reconciling clusters")
+	summary, err := scheduler.Reconcile(ctx, r, clusters, time.Now(), opts)
+	return clusters, summary, err
+}
+
+func reconcileCmd(c *cli.Context) error {
+	filter, err := clusterFilter(c)
+	if err != nil {
+		return err
+	}
+	opts, err := reconcileOptions(c)
+	if err != nil {
+		return err
+	}
+	_, summary, err := reconcile(mainCtx, clusterRunner(c), filter, opts)
+	writeSummary("reconcile", summary)
+	return err
+}
+
+func daemonCmd(c *cli.Context) error {
+	filter, err := clusterFilter(c)
+	if err != nil {
+		return err
+	}
+	opts, err := reconcileOptions(c)
+	if err != nil {
+		return err
+	}
+	// on termination signal, remaining clusters are skipped, while in-flight cluster operations are completed
+	opts.Graceful = true
+	interval := c.Duration("interval")
+	log.WithField("interval", interval).Info("starting cluster scheduler daemon")
+	for {
+		clusters, summary, err := reconcile(mainCtx, runner, filter, opts)
+		if err != nil && mainCtx.Err() == nil {
+			log.WithError(err).Error("failed to reconcile clusters")
+		}
+		if summary != nil {
+			log.WithFields(log.Fields{
+				"succeeded": len(summary.Succeeded),
+				"failed":    len(summary.Failed),
+				"skipped":   len(summary.Skipped),
+			}).Info("reconcile cycle completed")
+		}
+		// next cycle starts after previous one is completed: on the earliest cluster transition or after interval
+		wait := scheduler.NextReconcile(clusters, time.Now(), interval)
+		log.WithField("wait", wait).Debug("waiting for next reconcile cycle")
+		timer := time.NewTimer(wait)
+		select {
+		case <-mainCtx.Done():
+			timer.Stop()
+			log.Info("stopping cluster scheduler daemon")
+			return nil
+		case <-timer.C:
 		}
 	}
-	return nil
 }
 
 func init() {
@@ -151,18 +432,67 @@ func main() {
 				Usage:     "stop managed Kubernetes clusters",
 				UsageText: "use this command in manual mode only",
 				Action:    stopCmd,
+				Flags:     append([]cli.Flag{dryRunFlag, concurrencyFlag, failFastFlag}, filterFlags...),
 			},
 			{
 				Name:      "restart",
 				Usage:     "restart previously stopped managed Kubernetes clusters",
 				UsageText: "use this command in manual mode only",
 				Action:    restartCmd,
+				Flags:     append([]cli.Flag{dryRunFlag, concurrencyFlag, failFastFlag}, filterFlags...),
+			},
+			{
+				Name:      "restore",
+				Usage:     "restart managed Kubernetes clusters to node pools backup snapshot, even if clusters are running",
+				UsageText: "use this command in manual mode only",
+				Action:    restoreCmd,
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "snapshot",
+						Usage: "backup snapshot id, as shown by 'backup list' (default: the latest snapshot)",
+					},
+					dryRunFlag, concurrencyFlag, failFastFlag,
+				}, filterFlags...),
+			},
+			{
+				Name:  "backup",
+				Usage: "manage node pools backups",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "list node pools backup snapshots of managed Kubernetes clusters",
+						Action: backupListCmd,
+						Flags:  append([]cli.Flag{outputFlag}, filterFlags...),
+					},
+				},
 			},
 			{
 				Name:      "list",
 				Usage:     "list managed Kubernetes clusters",
 				UsageText: "use this command in manual mode only",
 				Action:    listCmd,
+				Flags:     append([]cli.Flag{outputFlag}, filterFlags...),
+			},
+			{
+				Name:      "reconcile",
+				Usage:     "stop or restart managed Kubernetes clusters according to their uptime schedule",
+				UsageText: "run this command periodically (e.g. from a CronJob)",
+				Action:    reconcileCmd,
+				Flags:     append(append([]cli.Flag{dryRunFlag, concurrencyFlag, failFastFlag}, protectFlags...), filterFlags...),
+			},
+			{
+				Name:      "daemon",
+				Usage:     "periodically stop or restart managed Kubernetes clusters according to their uptime schedule",
+				UsageText: "run this command as a long-running service (e.g. Kubernetes Deployment)",
+				Action:    daemonCmd,
+				Flags: append([]cli.Flag{
+					&cli.DurationFlag{
+						Name:  "interval",
+						Usage: "max reconcile interval; reconcile also runs on the earliest cluster schedule transition",
+						Value: 5 * time.Minute,
+					},
+					concurrencyFlag,
+				}, append(protectFlags, filterFlags...)...),
 			},
 		},
 		Flags: []cli.Flag{
@@ -181,6 +511,24 @@ func main() {
 				Usage:   "specify cluster type (eks, gke)",
 				Value:   "gke",
 			},
+			&cli.StringFlag{
+				Name:  "calendars",
+				Usage: "directory with holiday and blackout calendars (.yaml, .ics) referenced by 'cs-calendar' label",
+			},
+			&cli.StringFlag{
+				Name:  "backup-store",
+				Usage: "where to keep node groups backup on stop: labels(*), file://<dir>, gs://<bucket>/<prefix>, s3://<bucket>/<prefix>",
+				Value: "labels",
+			},
+			&cli.BoolFlag{
+				Name:  "drain",
+				Usage: "cordon nodes and evict pods (respecting PodDisruptionBudgets) before scaling node groups to 0",
+			},
+			&cli.DurationFlag{
+				Name:  "drain-timeout",
+				Usage: "max time to wait for pods eviction on drain; node groups are stopped anyway after timeout",
+				Value: 5 * time.Minute,
+			},
 		},
 		Name:    "cluster-scheduler",
 		Usage:   "cluster-scheduler CLI",
@@ -197,6 +545,12 @@ func main() {
 
 	err := app.Run(os.Args)
 	if err != nil {
+		// summary of failed clusters is already printed
+		var failed scheduler.Errors
+		if errors.As(err, &failed) {
+			log.Errorf("%d cluster(s) failed", len(failed))
+			os.Exit(exit_CLUSTERS_FAILED)
+		}
 		log.Fatal(err)
 	}
 }